@@ -1,34 +1,438 @@
 package main
 
 import (
-	"io"
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-var invalidCharsInFilenamesRegex = regexp.MustCompile("[/<>:\"\\|?*]")
+var invalidCharsInFilenamesRegex = regexp.MustCompile("[/\\\\<>:\"|?*]")
 
-func NewChatLogger(filename string) func(string) {
+const chatLogDateFormat = "2006-01-02"
+
+// chatLogDir is where logs for target (a channel or nick, or "" for the
+// server tab) on network go
+func chatLogDir(network, target string) string {
+	dir := filepath.Join(CHATLOG_DIR, invalidCharsInFilenamesRegex.ReplaceAllString(network, "_"))
+	if target != "" {
+		dir = filepath.Join(dir, invalidCharsInFilenamesRegex.ReplaceAllString(target, "_"))
+	}
+	return dir
+}
+
+const (
+	chatLogFlushInterval = 5 * time.Second
+	chatLogQueueSize     = 256
+	chatLogQueueTimeout  = 2 * time.Second // how long to wait for a full queue
+)
+
+// chatLogLine is something that happened in a tab, see messages.go
+type chatLogLine struct {
+	Type int    // CLIENT_MESSAGE...PRIVATE_MESSAGE
+	Nick string // who said it, if anyone
+	Raw  string // what they said, with formatting
+	Line string // how it looks in the plain text logs
+}
+
+// chatLogEntry is everything we know about a line, it's what goes in the
+// json logs and what the other formats are made from
+type chatLogEntry struct {
+	Time     string `json:"timestamp"`
+	Network  string `json:"network"`
+	Target   string `json:"target"`
+	Type     string `json:"type"`
+	Nick     string `json:"nick,omitempty"`
+	UserHost string `json:"userhost,omitempty"`
+	Raw      string `json:"raw"`
+	Text     string `json:"text"`
+}
+
+// chatLogWrite is what the writer goroutine gets for each line
+type chatLogWrite struct {
+	t     time.Time
+	entry *chatLogEntry
+	line  string
+}
+
+// chatLogger writes a tab's log to chatlogs/network/target/2006-01-02.log
+// (or another format, see logformats.go) from its own goroutine so handlers never wait on the
+// disk. lines are written in the order Println gets them and flushed every
+// few seconds and on Close.
+type chatLogger struct {
+	servState *serverState
+	target    string                   // channel or nick, "" for the server tab
+	userHost  func(nick string) string // can be nil
+
+	lines   chan *chatLogWrite
+	done    chan struct{}
+	closed  bool
+	dropped int // lines we gave up on since the last one we could queue
+	mu      *sync.Mutex
+}
+
+// chatLogs is every open logger so we can flush them all when we exit
+var chatLogs = struct {
+	open map[*chatLogger]bool
+	mu   *sync.Mutex
+}{map[*chatLogger]bool{}, &sync.Mutex{}}
+
+// NewChatLogger returns nil if logging is off, which is fine to use. the
+// network name is looked up for every line since it's only host:port
+// until ISUPPORT tells us the real one.
+func NewChatLogger(servState *serverState, target string, userHost func(nick string) string) *chatLogger {
 	if !clientCfg.ChatLogsEnabled {
-		return func(string) {}
+		return nil
+	}
+	cl := &chatLogger{
+		servState: servState,
+		target:    target,
+		userHost:  userHost,
+		lines:     make(chan *chatLogWrite, chatLogQueueSize),
+		done:      make(chan struct{}),
+		mu:        &sync.Mutex{},
+	}
+	chatLogs.mu.Lock()
+	chatLogs.open[cl] = true
+	chatLogs.mu.Unlock()
+	go cl.run()
+	return cl
+}
+
+func (cl *chatLogger) Println(line *chatLogLine) {
+	if cl == nil {
+		return
 	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.closed {
+		return
+	}
+	t := time.Now().In(cl.servState.chatLogLocation())
+	w := &chatLogWrite{t: t, line: line.Line}
+	w.entry = &chatLogEntry{
+		Time:    t.Format(time.RFC3339Nano),
+		Network: cl.servState.networkName,
+		Target:  cl.target,
+		Type:    msgTypeString(line.Type),
+		Nick:    line.Nick,
+		Raw:     line.Raw,
+	}
+	if line.Nick != "" && cl.userHost != nil {
+		w.entry.UserHost = cl.userHost(line.Nick)
+	}
+	// if the disk can't keep up whoever's printing waits for it, but not
+	// forever. once we've given up on a line we don't wait again until
+	// there's room, otherwise every line would hold things up.
+	if cl.dropped == 0 {
+		timeout := time.NewTimer(chatLogQueueTimeout)
+		defer timeout.Stop()
+		select {
+		case cl.lines <- w:
+			return
+		case <-timeout.C:
+		}
+	} else {
+		select {
+		case cl.lines <- w:
+			log.Printf("chat log for %s caught up, %d lines weren't logged", cl.target, cl.dropped)
+			cl.dropped = 0
+			return
+		default:
+		}
+	}
+	cl.dropped++
+	if cl.dropped == 1 {
+		log.Printf("chat log for %s can't keep up, dropping lines", cl.target)
+		if t := cl.servState.tab; t != nil {
+			// not while we're holding cl.mu, the server tab logs errors too
+			go clientError(t, "ERROR: chat log can't keep up, some lines won't be logged")
+		}
+	}
+}
+
+// Close writes out whatever's left and waits for it
+func (cl *chatLogger) Close() {
+	if cl == nil {
+		return
+	}
+	cl.mu.Lock()
+	if !cl.closed {
+		cl.closed = true
+		close(cl.lines)
+	}
+	cl.mu.Unlock()
+	<-cl.done
+
+	chatLogs.mu.Lock()
+	delete(chatLogs.open, cl)
+	chatLogs.mu.Unlock()
+}
+
+// closeChatLogs is for when we exit
+func closeChatLogs() {
+	chatLogs.mu.Lock()
+	open := []*chatLogger{}
+	for cl := range chatLogs.open {
+		open = append(open, cl)
+	}
+	chatLogs.mu.Unlock()
+	for _, cl := range open {
+		cl.Close()
+	}
+}
 
-	filename = invalidCharsInFilenamesRegex.ReplaceAllString(filename, "_") + ".log"
+// chatLogFile is one of the files a chatLogger has open
+type chatLogFile struct {
+	name string
+	f    *os.File
+	w    *bufio.Writer
+}
 
-	logger := func(message string) {
-		f, err := os.OpenFile(CHATLOG_DIR+filename, os.O_CREATE|os.O_APPEND, os.ModePerm)
-		checkErr(err)
-		defer f.Close()
-		io.WriteString(f, message+"\n")
+func openChatLogFile(name string) (*chatLogFile, error) {
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return nil, err
 	}
+	return &chatLogFile{name, f, bufio.NewWriter(f)}, nil
+}
 
-	// NOTE(tso): even if it's never called, the creation of a chat logger
-	//            means that logging began, right?
-	//            this might get annoying when joining channels by accident
-	//            and having a log file written
-	// -tso 7/11/2018 7:30:49 PM
-	logger(time.Now().Format("-----------------------Mon Jan 2 15:04:05 -0700 MST 2006-----------------------"))
+// Flush writes out what's buffered and lets the search index know
+func (lf *chatLogFile) Flush() error {
+	err := lf.w.Flush()
+	if err == nil {
+		// not here, a search might be holding on to the index
+		go chatLogIndex.Updated(lf.name)
+	}
+	return err
+}
 
-	return logger
+func (lf *chatLogFile) Close() error {
+	err := lf.Flush()
+	if cerr := lf.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (cl *chatLogger) run() {
+	defer close(cl.done)
+
+	files := map[string]*chatLogFile{} // by extension
+	failed := false                    // so we only complain once until it works again
+	fail := func(err error) {
+		if failed {
+			return
+		}
+		failed = true
+		log.Println("chat log error:", err)
+		if t := cl.servState.tab; t != nil {
+			// not from this goroutine, the server tab logs errors too
+			go clientError(t, "ERROR: couldn't write chat log: "+err.Error())
+		}
+	}
+	defer func() {
+		for _, lf := range files {
+			if err := lf.Close(); err != nil {
+				fail(err)
+			}
+		}
+	}()
+
+	// file returns the file to write to for format, starting a new one at
+	// midnight or if the network name changed
+	file := func(format *chatLogFormat, w *chatLogWrite) *chatLogFile {
+		ext := format.ext
+		name := filepath.Join(chatLogDir(cl.servState.networkName, cl.target), w.t.Format(chatLogDateFormat)+ext)
+		lf := files[ext]
+		if lf != nil && lf.name == name {
+			return lf
+		}
+		if lf != nil {
+			if err := lf.Close(); err != nil {
+				fail(err)
+			}
+			delete(files, ext)
+			go tidyChatLogs(false)
+		}
+		lf, err := openChatLogFile(name)
+		if err != nil {
+			fail(err)
+			return nil
+		}
+		files[ext] = lf
+		if format.header != nil {
+			// mark where logging began, and again every time we rotate
+			lf.w.WriteString(format.header(w.t) + "\n")
+		}
+		return lf
+	}
+
+	ticker := time.NewTicker(chatLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case w, ok := <-cl.lines:
+			if !ok {
+				return
+			}
+			w.entry.Text = stripFmtChars(w.entry.Raw)
+			ok = true
+			for _, format := range chatLogFormats() {
+				lf := file(format, w)
+				if lf == nil {
+					ok = false
+					continue
+				}
+				if _, err := lf.w.WriteString(format.line(w) + "\n"); err != nil {
+					fail(err)
+					ok = false
+				}
+			}
+			if ok {
+				failed = false
+			}
+		case <-ticker.C:
+			for _, lf := range files {
+				if err := lf.Flush(); err != nil {
+					fail(err)
+				}
+			}
+		}
+	}
+}
+
+// chatLogLocation is the time zone we change log files at midnight in
+func (servState *serverState) chatLogLocation() *time.Location {
+	if clientCfg.ChatLogRotate == "server" && servState.serverTime != nil {
+		return servState.serverTime
+	}
+	return time.Local
+}
+
+var (
+	serverClockRegex  = regexp.MustCompile(`(\d{1,2}):(\d{2})(?::(\d{2}))?`)
+	serverOffsetRegex = regexp.MustCompile(`([+-])(\d{1,2}):?(\d{2})\s*$`)
+)
+
+// parseServerTime works out the server's time zone from a TIME reply.
+// there's no standard format but some end with an offset e.g.
+// "Monday October 19 2026 -- 14:02:03 +00:00" and otherwise we guess from
+// the clock.
+func parseServerTime(str string, now time.Time) (*time.Location, bool) {
+	if m := serverOffsetRegex.FindStringSubmatch(str); m != nil {
+		h, _ := strconv.Atoi(m[2])
+		min, _ := strconv.Atoi(m[3])
+		offset := h*3600 + min*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone("server", offset), true
+	}
+	m := serverClockRegex.FindStringSubmatch(str)
+	if m == nil {
+		return nil, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	now = now.UTC()
+	offset := time.Duration(h-now.Hour())*time.Hour + time.Duration(min-now.Minute())*time.Minute
+	// time zones go from -12 to +14
+	if offset < -12*time.Hour {
+		offset += 24 * time.Hour
+	} else if offset > 14*time.Hour {
+		offset -= 24 * time.Hour
+	}
+	offset = offset.Round(15 * time.Minute)
+	return time.FixedZone("server", int(offset.Seconds())), true
+}
+
+var chatLogTidy = struct {
+	day string
+	mu  *sync.Mutex
+}{mu: &sync.Mutex{}}
+
+// tidyChatLogs gzips and deletes old logs (see ChatLogCompress and
+// ChatLogRetention), at most once a day unless force is true
+func tidyChatLogs(force bool) {
+	if !clientCfg.ChatLogCompress && clientCfg.ChatLogRetention <= 0 {
+		return
+	}
+	chatLogTidy.mu.Lock()
+	defer chatLogTidy.mu.Unlock()
+	today := time.Now()
+	if !force && chatLogTidy.day == today.Format(chatLogDateFormat) {
+		return
+	}
+	chatLogTidy.day = today.Format(chatLogDateFormat)
+
+	filepath.Walk(CHATLOG_DIR, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if err := tidyChatLog(path, today, clientCfg.ChatLogCompress, clientCfg.ChatLogRetention); err != nil {
+			log.Println("couldn't tidy chat log:", err)
+		}
+		return nil
+	})
+}
+
+// tidyChatLog deletes path if it's from more than retention days before
+// today or compresses it if it's from before yesterday. yesterday is left
+// alone in case someone's still writing to it in a server's time zone.
+func tidyChatLog(path string, today time.Time, compress bool, retention int) error {
+	// 2006-01-02.log, 2006-01-02.irssi.log.gz...
+	name := filepath.Base(path)
+	i := strings.Index(name, ".")
+	if i == -1 {
+		return nil
+	}
+	date := name[:i]
+	if _, err := time.Parse(chatLogDateFormat, date); err != nil {
+		return nil
+	}
+	if retention > 0 && date < today.AddDate(0, 0, -retention).Format(chatLogDateFormat) {
+		return os.Remove(path)
+	}
+	if !compress || strings.HasSuffix(path, ".gz") || date >= today.AddDate(0, 0, -1).Format(chatLogDateFormat) {
+		return nil
+	}
+	return gzipFile(path)
+}
+
+// gzipFile replaces path with path.gz. if that's already there (because
+// something got logged late) this goes on the end of it, gzip is fine with
+// that.
+func gzipFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(f)
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
 }
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testChatLogs sets clientCfg to cfg and points CHATLOG_DIR at a temporary
+// directory, call what it returns to put them back
+func testChatLogs(t *testing.T, cfg *clientConfig) func() {
+	dir, err := ioutil.TempDir("", "chatlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatLogDir := CHATLOG_DIR
+	CHATLOG_DIR = dir
+	clientCfg = cfg
+	return func() {
+		clientCfg = nil
+		CHATLOG_DIR = chatLogDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestChatLogger(t *testing.T) {
+	defer testChatLogs(t, &clientConfig{ChatLogsEnabled: true, ChatLogFormat: "both"})()
+	servState := &serverState{networkName: "chopsuey-test-network"}
+
+	cl := NewChatLogger(servState, "#test", func(nick string) string {
+		return "~" + nick + "@example.com"
+	})
+	wg := &sync.WaitGroup{}
+	mu := &sync.Mutex{}
+	n := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				// the order lines go in is the order they come out
+				mu.Lock()
+				cl.Println(&chatLogLine{PRIVATE_MESSAGE, "tso", "\x02" + fmt.Sprint(n), fmt.Sprint(n)})
+				n++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	cl.Close()
+	cl.Println(&chatLogLine{Line: "after close"})
+
+	filename := filepath.Join(chatLogDir(servState.networkName, "#test"), time.Now().Format(chatLogDateFormat))
+	data, err := ioutil.ReadFile(filename + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1001 {
+		t.Fatalf("expected 1001 lines got %d", len(lines))
+	}
+	for i, line := range lines[1:] {
+		if line != fmt.Sprint(i) {
+			t.Fatalf("line %d: expected %d got %q", i, i, line)
+		}
+	}
+
+	data, err = ioutil.ReadFile(filename + ".jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("expected 1000 json lines got %d", len(lines))
+	}
+	for i, line := range lines {
+		entry := &chatLogEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, entry.Time); err != nil {
+			t.Errorf("line %d: bad timestamp: %v", i, err)
+		}
+		entry.Time = ""
+		expected := chatLogEntry{"", "chopsuey-test-network", "#test", "PRIVATE_MESSAGE", "tso", "~tso@example.com", "\x02" + fmt.Sprint(i), fmt.Sprint(i)}
+		if *entry != expected {
+			t.Fatalf("line %d: expected %#v got %#v", i, expected, *entry)
+		}
+	}
+
+	var disabled *chatLogger
+	disabled.Println(&chatLogLine{Line: "nothing"})
+	disabled.Close()
+}
+
+func TestChatLoggerFull(t *testing.T) {
+	defer testChatLogs(t, &clientConfig{ChatLogsEnabled: true})()
+	// nothing reading the queue, like when the disk is too slow
+	cl := &chatLogger{
+		servState: &serverState{},
+		lines:     make(chan *chatLogWrite, 1),
+		done:      make(chan struct{}),
+		mu:        &sync.Mutex{},
+	}
+	cl.Println(&chatLogLine{Line: "0"})
+
+	// waits for room
+	go func() {
+		time.Sleep(chatLogQueueTimeout / 4)
+		<-cl.lines
+	}()
+	cl.Println(&chatLogLine{Line: "1"})
+	if cl.dropped != 0 {
+		t.Errorf("expected nothing dropped got %d", cl.dropped)
+	}
+
+	// gives up waiting once and then doesn't wait again
+	start := time.Now()
+	for i := 2; i < 5; i++ {
+		cl.Println(&chatLogLine{Line: fmt.Sprint(i)})
+	}
+	if cl.dropped != 3 {
+		t.Errorf("expected 3 dropped got %d", cl.dropped)
+	}
+	if elapsed := time.Since(start); elapsed < chatLogQueueTimeout || elapsed > chatLogQueueTimeout*2 {
+		t.Errorf("expected to wait %v once, took %v", chatLogQueueTimeout, elapsed)
+	}
+
+	<-cl.lines
+	cl.Println(&chatLogLine{Line: "5"})
+	if cl.dropped != 0 {
+		t.Errorf("expected dropped to reset got %d", cl.dropped)
+	}
+	if w := <-cl.lines; w.line != "5" {
+		t.Errorf("expected %q got %q", "5", w.line)
+	}
+}
+
+func TestChatLogDir(t *testing.T) {
+	for _, test := range []struct {
+		network, target, expected string
+	}{
+		{"Rizon", "#chopsuey", filepath.Join(CHATLOG_DIR, "Rizon", "#chopsuey")},
+		{"irc.rizon.net:6697", "", filepath.Join(CHATLOG_DIR, "irc.rizon.net_6697")},
+		{"Rizon", "=tso", filepath.Join(CHATLOG_DIR, "Rizon", "=tso")},
+		{"Rizon", "a/b", filepath.Join(CHATLOG_DIR, "Rizon", "a_b")},
+		{"Rizon", `a\b|c`, filepath.Join(CHATLOG_DIR, "Rizon", "a_b_c")},
+	} {
+		if dir := chatLogDir(test.network, test.target); dir != test.expected {
+			t.Errorf("chatLogDir(%q, %q): expected %q got %q", test.network, test.target, test.expected, dir)
+		}
+	}
+}
+
+func TestParseServerTime(t *testing.T) {
+	now := time.Date(2026, 10, 19, 14, 2, 0, 0, time.UTC)
+	for _, test := range []struct {
+		str    string
+		offset int
+		ok     bool
+	}{
+		{"Monday October 19 2026 -- 14:02:03 +00:00", 0, true},
+		{"Monday October 19 2026 -- 10:02:03 -04:00", -4 * 3600, true},
+		{"Mon Oct 19 2026 19:32:03 +0530", 5*3600 + 30*60, true},
+		{"Mon Oct 19 16:01:58 2026", 2 * 3600, true},
+		{"Tue Oct 20 01:02:00 2026", 11 * 3600, true},
+		{"Mon Oct 19 03:02:00 2026", -11 * 3600, true},
+		{"whenever", 0, false},
+	} {
+		loc, ok := parseServerTime(test.str, now)
+		if ok != test.ok {
+			t.Errorf("parseServerTime(%q): expected %v got %v", test.str, test.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if _, offset := now.In(loc).Zone(); offset != test.offset {
+			t.Errorf("parseServerTime(%q): expected offset %d got %d", test.str, test.offset, offset)
+		}
+	}
+}
+
+func TestTidyChatLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chatlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	today := time.Date(2026, 10, 19, 0, 30, 0, 0, time.Local)
+	for _, name := range []string{"2026-10-19.log", "2026-10-18.log", "2026-10-17.log", "2026-10-01.log", "2026-09-01.log.gz", "notes.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("hi\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := tidyChatLog(filepath.Join(dir, name), today, true, 14); err != nil {
+			t.Errorf("tidyChatLog(%q): %v", name, err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	got := map[string]bool{}
+	for _, f := range files {
+		got[filepath.Base(f)] = true
+	}
+	expected := []string{"2026-10-19.log", "2026-10-18.log", "2026-10-17.log.gz", "notes.txt"}
+	if len(got) != len(expected) {
+		t.Errorf("expected %v got %v", expected, got)
+	}
+	for _, name := range expected {
+		if !got[name] {
+			t.Errorf("expected %s to be there, got %v", name, got)
+		}
+	}
+}
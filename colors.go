@@ -439,6 +439,11 @@ func applyThemeToTab(t tab) {
 		applyThemeToTabPage(t.tabPage, brush)
 		applyThemeToRichEdit(t.textBuffer)
 		applyThemeToLineEdit(&t.textInput.LineEdit, brush, rgb)
+	case *tabDccChat:
+		t := t.(*tabDccChat)
+		applyThemeToTabPage(t.tabPage, brush)
+		applyThemeToRichEdit(t.textBuffer)
+		applyThemeToLineEdit(&t.textInput.LineEdit, brush, rgb)
 	default:
 		log.Printf("type %T does not support theming yet!!", t)
 	}
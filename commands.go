@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -52,8 +53,10 @@ var (
 		"close": clientCommandDoc{"/close [part or quit message]",
 			"closes current tab with optional part or quit message\nif on a channel, same as /part\nif on a server same as /quit"},
 		"ctcp": clientCommandDoc{"/ctcp [nick] [message] [args...]", "send a CTCP message to nick with optional arguments"},
-		"join": clientCommandDoc{"/join [#channel]", "join a channel"},
+		"join": clientCommandDoc{"/join #channel[,#channel2...] [key[,key2...]]", "join one or more channels, keys are given in the same order as the channels"},
 		"kick": clientCommandDoc{"/kick [nick] [(optional) reason...]", "remove a user from a channel (if you have op)"},
+		"knock": clientCommandDoc{"/knock #channel [message...]",
+			"ask the ops of an invite-only, keyed or full channel to let you in (if the server supports it)"},
 		"list": clientCommandDoc{"/list", "opens a tab with all the channels on the server"},
 		"me":   clientCommandDoc{"/me [message...]", "*tso slaps you around with a big trout*"},
 		"mode": clientCommandDoc{"/mode [#channel or your nick] [mode] [nicks...]",
@@ -63,9 +66,51 @@ var (
 		"notice": clientCommandDoc{"/notice [#channel or nick] [message...]",
 			"sends a NOTICE. please dont send NOTICEs to channels..."},
 		"part":   clientCommandDoc{"/part [message...]", "(doesnt close tab) leave a channel with optional message"},
+		"ping":   clientCommandDoc{"/ping [nick or #channel]", "send a CTCP PING and show how long the reply took"},
 		"rejoin": clientCommandDoc{"/rejoin", "join a channel you have left (either by being kicked or having parted)"},
 		"topic":  clientCommandDoc{"/topic [new topic...]", "set or view the topic for the channel"},
 
+		"bans": clientCommandDoc{"/bans [search]",
+			"show the ban list for the current channel\nsearch can be part of a mask or setter, or a mask with * and ?"},
+		"excepts": clientCommandDoc{"/excepts [search]", "show the ban exception (+e) list for the current channel"},
+		"invex":   clientCommandDoc{"/invex [search]", "show the invite exception (+I) list for the current channel"},
+		"unban": clientCommandDoc{"/unban [mask or search...] [-older duration]",
+			"remove every ban matching mask or search from the current channel\n" +
+				"-older removes only bans set longer ago than duration, e.g.\n" +
+				"/unban -older 30d\nremoves every ban older than 30 days"},
+		"unexcept": clientCommandDoc{"/unexcept [mask or search...] [-older duration]", "same as /unban but for ban exceptions (+e)"},
+		"uninvex":  clientCommandDoc{"/uninvex [mask or search...] [-older duration]", "same as /unban but for invite exceptions (+I)"},
+
+		"ignore": clientCommandDoc{"/ignore [nick or mask] [-types privmsg,notice,ctcp,action,joinpart,invite,dcc] [-network|-channel] [-for duration] [-server]",
+			"stop seeing messages from someone, nicks are turned into *!*@host if we know their host\n" +
+				"-types only ignores those kinds of messages, -network or -channel only ignores them there\n" +
+				"-for stops ignoring them after a while e.g. /ignore spammer -for 1h\n" +
+				"-server also has the server block them with SILENCE, if it can\n" +
+				"with no arguments shows everyone you're ignoring"},
+		"unignore": clientCommandDoc{"/unignore [nick, mask or number from /ignore]", "stop ignoring someone"},
+		"accept": clientCommandDoc{"/accept [nick...] or /accept -[nick...]",
+			"let someone message you while you're in +g (/callerid on) mode or take them off the list again\n" +
+				"with no arguments shows who you've accepted"},
+		"callerid": clientCommandDoc{"/callerid [on|off]", "only get private messages from people you've /accept'd (usermode +g)"},
+		"highlight": clientCommandDoc{"/highlight [add|del] [word|regex|exclude|mute] [value...] [-network] or /highlight [on|off]",
+			"words and regexes highlight messages as well as your nick, exclude is a nick!user@host mask that never\n" +
+				"highlights (e.g. bots) and mute is a channel where nothing does (the current one if you leave it out)\n" +
+				"-network only applies it on this network. with no arguments shows the rules"},
+		"filter": clientCommandDoc{"/filter add [-regex] [-in|-out] [-channel] [pattern] [replacement...] or /filter del [number]",
+			"replaces words in messages before they're shown (-in) or sent (-out), both if you leave it out\n" +
+				"patterns are whole words in any case unless -regex is given, use => between them for phrases\n" +
+				"e.g. /filter add -in the cloud => my butt. -channel only applies it here. with no arguments shows the filters"},
+		"import": clientCommandDoc{"/import [irssi|weechat|znc|mirc] [file or folder] [-network name] [-channel name]",
+			"copies another client's logs into chatlogs/ in the formats you log in (see chatlogformat in config.json)\n" +
+				"the network and channel come from the file names unless you say otherwise. days you already have logs for\n" +
+				"(including today) are skipped"},
+		"grep": clientCommandDoc{"/grep [-network name] [-channel name] [-here] [-nick nick] [-from date] [-to date] [-regex pattern] [-context n] [-max n] [words...]",
+			"searches the chat logs for lines with all of the words (in any case) that match everything else\n" +
+				"dates are 2006-01-02 or how long ago e.g. 7d. -here is this network and channel. shows the last 20 matches with\n" +
+				"a line either side unless you say otherwise. -regex on its own needs a channel or date too"},
+		"search": clientCommandDoc{"/search [-network name] [-channel name] [-here] [-nick nick] [-from date] [-to date] [-regex pattern] [-context n] [-max n] [words...]",
+			"same as /grep"},
+
 		"version": clientCommandDoc{"/version [nick]", "find out what client someone is using"},
 		"whois":   clientCommandDoc{"/whois [nick]", "find out a user's true identity"},
 
@@ -78,6 +123,17 @@ var (
 		"exit": clientCommandDoc{"/exit", "SHUT\nIT\nDOWN"},
 
 		// experimental/WIP
+		"dcc": clientCommandDoc{"/dcc [list|accept|decline|cancel] [transfer #] or /dcc chat [nick] or /dcc limit [#transfer] [rate|off]",
+			"list file transfers, accept or decline a file someone offered to send you, or stop a transfer\n" +
+				"/dcc chat starts a private chat directly with nick (or accepts theirs) that doesn't go through the server\n" +
+				"/dcc limit shows or sets the bandwidth limit for every transfer together, or just one, e.g. /dcc limit 500K\n" +
+				"with no arguments opens the transfers tab"},
+		"xdcc": clientCommandDoc{"/xdcc [search|get|list|queue|cancel] [args...]",
+			"/xdcc search [words...] shows packs that bots have announced with every word in the name\n" +
+				"/xdcc get [bot] [#pack...] asks bot for packs one at a time and accepts them when they arrive\n" +
+				"/xdcc list [bot] asks bot for its packlist, /xdcc queue shows what you've asked for\n" +
+				"/xdcc cancel [bot] [#pack] stops waiting for a pack\n" +
+				"with no arguments opens the xdcc tab"},
 		"send": clientCommandDoc{"/send [nick] [filepath (optional)]",
 			"offer to send a file to a user, if no file is specified a dialog will open to pick one\n" +
 				"please note that file transfers dont work in all clients\n" +
@@ -112,9 +168,11 @@ func init() {
 		"ctcp":    ctcpCmd,
 		"join":    joinCmd,
 		"kick":    kickCmd,
+		"knock":   knockCmd,
 		"list":    listCmd,
 		"me":      meCmd,
 		"mode":    modeCmd,
+		"ping":    pingCmd,
 		"msg":     privmsgCmd,
 		"privmsg": privmsgCmd,
 		"nick":    nickCmd,
@@ -125,6 +183,14 @@ func init() {
 		"version": versionCmd,
 		"whois":   whoisCmd,
 
+		// channel lists
+		"bans":     modeListCmd("bans", 'b'),
+		"excepts":  modeListCmd("excepts", 'e'),
+		"invex":    modeListCmd("invex", 'I'),
+		"unban":    modeListRemoveCmd("unban", "bans", 'b'),
+		"unexcept": modeListRemoveCmd("unexcept", "excepts", 'e'),
+		"uninvex":  modeListRemoveCmd("uninvex", "invex", 'I'),
+
 		// stuff no one uses anymore
 		"away":   awayCmd,
 		"unaway": unawayCmd,
@@ -134,7 +200,9 @@ func init() {
 		"exit": exitCmd,
 
 		// experimental/WIP
+		"dcc":  dccCmd,
 		"send": sendCmd,
+		"xdcc": xdccCmd,
 
 		// scripting
 		"call":       scriptCmd,
@@ -151,8 +219,15 @@ func init() {
 		"theme":      themeCmd,
 
 		// harmful
-		"ignore":   ignoreCmd,
-		"unignore": unignoreCmd,
+		"ignore":    ignoreCmd,
+		"unignore":  unignoreCmd,
+		"accept":    acceptCmd,
+		"callerid":  callerIDCmd,
+		"highlight": highlightCmd,
+		"filter":    filterCmd,
+		"import":    importCmd,
+		"grep":      grepCmd,
+		"search":    grepCmd,
 	}
 }
 
@@ -223,6 +298,21 @@ func quitCmd(ctx *commandContext, args ...string) {
 		ctx.servState.channelList.Close()
 		ctx.servState.channelList = nil
 	}
+	if ctx.servState.transfers != nil {
+		ctx.servState.transfers.Close()
+		ctx.servState.transfers = nil
+	}
+	if ctx.servState.xdcc != nil {
+		ctx.servState.xdcc.Close()
+		ctx.servState.xdcc = nil
+	}
+	for _, chat := range dccChats.ForServer(ctx.servState) {
+		chat.Close()
+		if chat.tab != nil {
+			chat.tab.Close()
+		}
+		dccChats.Remove(chat)
+	}
 	ctx.servState.tab.Close()
 
 	if tabMan.Len() == 0 {
@@ -331,6 +421,9 @@ func closeCmd(ctx *commandContext, args ...string) {
 		delete(ctx.servState.channels, ctx.chanState.channel)
 	} else if ctx.pmState != nil {
 		delete(ctx.servState.privmsgs, ctx.pmState.nick)
+	} else if t, ok := ctx.tab.(*tabDccChat); ok {
+		t.chat.Close()
+		dccChats.Remove(t.chat)
 	}
 	tabCtx := &tabWithContext{tab: ctx.tab}
 	tabCtx.servConn = ctx.servConn
@@ -353,15 +446,56 @@ func ctcpCmd(ctx *commandContext, args ...string) {
 	ctx.servConn.conn.Ctcp(args[0], args[1], args[2:]...)
 }
 
+func pingCmd(ctx *commandContext, args ...string) {
+	if !requireServConn(ctx) {
+		return
+	}
+	target := ""
+	switch {
+	case len(args) == 1:
+		target = args[0]
+	case len(args) == 0 && ctx.chanState != nil:
+		target = ctx.chanState.channel
+	case len(args) == 0 && ctx.pmState != nil:
+		target = ctx.pmState.nick
+	default:
+		usage(ctx, "ping")
+		return
+	}
+	ctx.servConn.conn.Ctcp(target, "PING", ctx.servConn.ctcpPing.New())
+}
+
 func joinCmd(ctx *commandContext, args ...string) {
 	if !requireServConn(ctx) {
 		return
 	}
-	if len(args) != 1 || len(args[0]) < 2 || args[0][0] != '#' {
+	if len(args) < 1 {
+		usage(ctx, "join")
+		return
+	}
+	// /join #a,#b key1,key2 or /join #channel key or /join #a #b #c
+	channels := []*autojoinChannel{}
+	keys := []string{}
+	for _, arg := range args {
+		for _, name := range strings.Split(arg, ",") {
+			if name == "" {
+				continue
+			}
+			if isChannel(name) {
+				channels = append(channels, &autojoinChannel{Channel: name})
+			} else {
+				keys = append(keys, name)
+			}
+		}
+	}
+	if len(channels) == 0 || len(keys) > len(channels) {
 		usage(ctx, "join")
 		return
 	}
-	ctx.servConn.conn.Join(args[0])
+	for i, key := range keys {
+		channels[i].Key = key
+	}
+	ctx.servConn.Join(channels...)
 }
 
 func kickCmd(ctx *commandContext, args ...string) {
@@ -379,6 +513,25 @@ func kickCmd(ctx *commandContext, args ...string) {
 	}
 }
 
+func knockCmd(ctx *commandContext, args ...string) {
+	if !requireServConn(ctx) {
+		return
+	}
+	if !ctx.servConn.canKnock() {
+		clientError(ctx.tab, "ERROR: "+ctx.servState.networkName+" doesn't support KNOCK")
+		return
+	}
+	if len(args) < 1 || !isChannel(args[0]) {
+		usage(ctx, "knock")
+		return
+	}
+	line := "KNOCK " + args[0]
+	if len(args) > 1 {
+		line += " :" + strings.Join(args[1:], " ")
+	}
+	ctx.servConn.conn.Raw(line)
+}
+
 func listCmd(ctx *commandContext, args ...string) {
 	if !requireServConn(ctx) {
 		return
@@ -398,14 +551,23 @@ func listCmd(ctx *commandContext, args ...string) {
 }
 
 func meCmd(ctx *commandContext, args ...string) {
-	if !requireServConn(ctx) {
-		return
-	}
 	msg := strings.Join(args, " ")
 	if len(args) == 0 {
 		usage(ctx, "me")
 		return
 	}
+	if t, ok := ctx.tab.(*tabDccChat); ok {
+		msg = wordFilters.Apply(FILTER_OUT, t.chat.nick, msg)
+		if err := t.chat.Action(msg); err != nil {
+			clientError(ctx.tab, "ERROR: not sent: "+err.Error())
+			return
+		}
+		actionMessage(ctx.tab, ctx.servState.user.nick, msg)
+		return
+	}
+	if !requireServConn(ctx) {
+		return
+	}
 	var dest string
 	if ctx.chanState != nil {
 		dest = ctx.chanState.channel
@@ -415,6 +577,7 @@ func meCmd(ctx *commandContext, args ...string) {
 		clientError(ctx.tab, "ERROR: /me can only be used in channels and private messages")
 		return
 	}
+	msg = wordFilters.Apply(FILTER_OUT, dest, msg)
 	ctx.servConn.conn.Action(dest, msg)
 	actionMessage(ctx.tab, ctx.servState.user.nick, msg)
 }
@@ -450,7 +613,7 @@ func privmsgCmd(ctx *commandContext, args ...string) {
 		return
 	}
 	nick := args[0]
-	msg := strings.Join(args[1:], " ")
+	msg := wordFilters.Apply(FILTER_OUT, nick, strings.Join(args[1:], " "))
 
 	if isService(nick) {
 		ctx.servConn.conn.Privmsg(nick, msg)
@@ -488,7 +651,7 @@ func noticeCmd(ctx *commandContext, args ...string) {
 		usage(ctx, "notice")
 		return
 	}
-	msg := strings.Join(args[1:], " ")
+	msg := wordFilters.Apply(FILTER_OUT, args[0], strings.Join(args[1:], " "))
 	ctx.servConn.conn.Notice(args[0], msg)
 	noticeMessage(ctx.tab, ctx.servState.user.nick, args[0], msg)
 }
@@ -509,8 +672,9 @@ func rejoinCmd(ctx *commandContext, args ...string) {
 		return
 	}
 	if ctx.chanState != nil {
+		channel := &autojoinChannel{ctx.chanState.channel, ctx.chanState.key}
 		ctx.servConn.Part(ctx.chanState.channel, "rejoining...", ctx.servState)
-		ctx.servConn.conn.Join(ctx.chanState.channel)
+		ctx.servConn.Join(channel)
 	} else {
 		clientError(ctx.tab, "ERROR: /rejoin only works for channels.")
 	}
@@ -553,6 +717,102 @@ func whoisCmd(ctx *commandContext, args ...string) {
 	ctx.servConn.conn.Whois(args[0])
 }
 
+func modeListCmd(cmd string, mode byte) clientCommand {
+	return func(ctx *commandContext, args ...string) {
+		if !requireServConn(ctx) {
+			return
+		}
+		if ctx.chanState == nil {
+			clientError(ctx.tab, "/"+cmd+" only works for channels.")
+			return
+		}
+		ml := ctx.chanState.modeList(mode)
+		search := strings.Join(args, " ")
+		if ml.Complete() {
+			printModeList(ctx.tab, ctx.chanState, ml, search)
+			return
+		}
+		// printed when the end of list arrives
+		ml.SetPendingSearch(search)
+		ctx.servConn.conn.Mode(ctx.chanState.channel, string(mode))
+	}
+}
+
+func modeListRemoveCmd(cmd, listCmd string, mode byte) clientCommand {
+	return func(ctx *commandContext, args ...string) {
+		if !requireServConn(ctx) {
+			return
+		}
+		if ctx.chanState == nil {
+			clientError(ctx.tab, "/"+cmd+" only works for channels.")
+			return
+		}
+		ml := ctx.chanState.modeList(mode)
+
+		var older time.Duration
+		search := []string{}
+		for i := 0; i < len(args); i++ {
+			if args[i] == "-older" && i+1 < len(args) {
+				d, err := parseDuration(args[i+1])
+				if err != nil {
+					clientError(ctx.tab, "invalid duration:", args[i+1])
+					return
+				}
+				older = d
+				i++
+				continue
+			}
+			search = append(search, args[i])
+		}
+		if len(search) == 0 && older == 0 {
+			usage(ctx, cmd)
+			return
+		}
+
+		masks := []string{}
+		seen := map[string]bool{}
+		addMask := func(mask string) {
+			if !seen[strings.ToLower(mask)] {
+				seen[strings.ToLower(mask)] = true
+				masks = append(masks, mask)
+			}
+		}
+		if older > 0 {
+			if !ml.Complete() {
+				clientError(ctx.tab, "don't have the "+ml.Name()+" list for "+ctx.chanState.channel+" yet, try /"+listCmd+" first")
+				return
+			}
+			if len(search) == 0 {
+				search = []string{""}
+			}
+			for _, s := range search {
+				for _, e := range ml.OlderThan(s, older) {
+					addMask(e.mask)
+				}
+			}
+		} else {
+			for _, s := range search {
+				entries := ml.Search(s)
+				if len(entries) == 0 && strings.ContainsAny(s, "!@*") {
+					// not in our copy of the list but could still be set
+					addMask(s)
+				}
+				for _, e := range entries {
+					addMask(e.mask)
+				}
+			}
+		}
+
+		if len(masks) == 0 {
+			clientMessage(ctx.tab, now(), "no matching "+pluralize(ml.Name(), 0)+" on "+ctx.chanState.channel)
+			return
+		}
+		clientMessage(ctx.tab, now(), fmt.Sprintf("removing %d %s from %s",
+			len(masks), pluralize(ml.Name(), len(masks)), ctx.chanState.channel))
+		sendModeList(ctx.servConn, ctx.chanState.channel, false, mode, masks)
+	}
+}
+
 func awayCmd(ctx *commandContext, args ...string) {
 	if !requireServConn(ctx) {
 		return
@@ -625,13 +885,206 @@ func exitCmd(ctx *commandContext, args ...string) {
 	exit()
 }
 
+func dccCmd(ctx *commandContext, args ...string) {
+	if !requireServConn(ctx) {
+		return
+	}
+	if len(args) == 0 {
+		ctx.servState.Transfers(ctx.servConn)
+		return
+	}
+	if args[0] == "list" {
+		transfers := dccTransfers.ForServer(ctx.servState)
+		if len(transfers) == 0 {
+			clientMessage(ctx.tab, now(), "no file transfers")
+			return
+		}
+		clientMessage(ctx.tab, now(), fmt.Sprintf("%d %s:", len(transfers), pluralize("transfer", len(transfers))))
+		for _, tr := range transfers {
+			clientMessage(ctx.tab, tr.String())
+		}
+		return
+	}
+	if args[0] == "limit" {
+		dccLimit(ctx, args[1:]...)
+		return
+	}
+	if len(args) != 2 {
+		usage(ctx, "dcc")
+		return
+	}
+	if args[0] == "chat" {
+		if chat := dccChats.Find(ctx.servState, args[1], true, DCC_PENDING); chat != nil {
+			chat.Accept()
+			return
+		}
+		if _, err := dccChatOffer(ctx.servConn, ctx.servState, args[1]); err != nil {
+			clientError(ctx.tab, "ERROR: couldn't start DCC CHAT: "+err.Error())
+			return
+		}
+		clientMessage(ctx.tab, now(), "asking "+args[1]+" to DCC CHAT...")
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+	tr := dccTransfers.Get(id)
+	if err != nil || tr == nil {
+		clientError(ctx.tab, "ERROR: no such transfer: "+args[1])
+		return
+	}
+	switch args[0] {
+	case "accept":
+		err = tr.Accept()
+	case "decline":
+		err = tr.Decline()
+	case "cancel":
+		err = tr.Cancel()
+	default:
+		usage(ctx, "dcc")
+		return
+	}
+	if err != nil {
+		clientError(ctx.tab, "ERROR: "+err.Error())
+	}
+}
+
+// dccLimit is /dcc limit [transfer #] [rate|off]
+func dccLimit(ctx *commandContext, args ...string) {
+	rateString := func(rate int64) string {
+		if rate <= 0 {
+			return "unlimited"
+		}
+		return humanSize(rate) + "/s"
+	}
+	limiter, what := dccBandwidth, "all transfers"
+	if len(args) > 0 && strings.HasPrefix(args[0], "#") {
+		id, err := strconv.Atoi(args[0][1:])
+		tr := dccTransfers.Get(id)
+		if err != nil || tr == nil {
+			clientError(ctx.tab, "ERROR: no such transfer: "+args[0])
+			return
+		}
+		limiter, what = tr.rate, "transfer "+args[0]
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		clientMessage(ctx.tab, now(), "bandwidth limit for "+what+": "+rateString(limiter.Rate()))
+		return
+	}
+	var rate int64
+	if args[0] != "off" {
+		var err error
+		rate, err = parseSize(args[0])
+		if err != nil {
+			clientError(ctx.tab, "ERROR: "+err.Error())
+			return
+		}
+	}
+	limiter.SetRate(rate)
+	clientMessage(ctx.tab, now(), "bandwidth limit for "+what+" is now "+rateString(rate))
+}
+
 func sendCmd(ctx *commandContext, args ...string) {
 	if !requireServConn(ctx) {
 		return
 	}
+	if len(args) < 1 {
+		usage(ctx, "send")
+		return
+	}
 	who := args[0]
-	file := "rfc2812.txt"
-	fileTransfer(ctx.servConn, who, file)
+	send := func(path string) {
+		tr, err := dccSend(ctx.servConn, ctx.servState, who, path)
+		if err != nil {
+			clientError(ctx.tab, "ERROR: couldn't send "+path+": "+err.Error())
+			return
+		}
+		if state, _, _ := tr.State(); state == DCC_QUEUED {
+			clientMessage(ctx.tab, now(), fmt.Sprintf("DCC #%d: queued %s (%s) for %s, already sending %d %s",
+				tr.id, tr.filename, humanSize(tr.size), who, clientCfg.DccMaxSends, pluralize("file", clientCfg.DccMaxSends)))
+		} else {
+			clientMessage(ctx.tab, now(), fmt.Sprintf("DCC #%d: offering %s (%s) to %s...", tr.id, tr.filename, humanSize(tr.size), who))
+		}
+		ctx.servState.refreshTransfers()
+	}
+	if len(args) > 1 {
+		send(strings.Join(args[1:], " "))
+		return
+	}
+	mw.WindowBase.Synchronize(func() {
+		dlg := &walk.FileDialog{Title: "Send a file to " + who}
+		if ok, err := dlg.ShowOpen(mw); err == nil && ok {
+			go send(dlg.FilePath)
+		}
+	})
+}
+
+func xdccCmd(ctx *commandContext, args ...string) {
+	if !requireServConn(ctx) {
+		return
+	}
+	if len(args) == 0 {
+		ctx.servState.Xdcc(ctx.servConn)
+		return
+	}
+	xdcc := ctx.servConn.xdcc
+	packNumber := func(str string) (int, bool) {
+		n, err := strconv.Atoi(strings.TrimPrefix(str, "#"))
+		if err != nil || n < 1 {
+			clientError(ctx.tab, "ERROR: not a pack number: "+str)
+			return 0, false
+		}
+		return n, true
+	}
+	switch args[0] {
+	case "search":
+		packs := xdcc.Search(args[1:]...)
+		if len(packs) == 0 {
+			clientMessage(ctx.tab, now(), "no packs found")
+			return
+		}
+		clientMessage(ctx.tab, now(), fmt.Sprintf("%d %s:", len(packs), pluralize("pack", len(packs))))
+		for _, pack := range packs {
+			clientMessage(ctx.tab, fmt.Sprintf("%s #%d %s %s", pack.bot, pack.number,
+				color("["+pack.size+"]", LightGrey), bold(pack.name)))
+		}
+	case "get":
+		if len(args) < 3 {
+			usage(ctx, "xdcc")
+			return
+		}
+		for _, arg := range args[2:] {
+			if n, ok := packNumber(arg); ok {
+				xdcc.Request(args[1], n)
+			}
+		}
+	case "list":
+		if len(args) != 2 {
+			usage(ctx, "xdcc")
+			return
+		}
+		ctx.servConn.conn.Privmsg(args[1], "XDCC LIST")
+	case "queue":
+		requests := xdcc.Requests()
+		if len(requests) == 0 {
+			clientMessage(ctx.tab, now(), "no XDCC requests")
+			return
+		}
+		for _, req := range requests {
+			clientMessage(ctx.tab, req.String())
+		}
+	case "cancel":
+		if len(args) != 3 {
+			usage(ctx, "xdcc")
+			return
+		}
+		if n, ok := packNumber(args[2]); ok {
+			if err := xdcc.Cancel(args[1], n); err != nil {
+				clientError(ctx.tab, "ERROR: "+err.Error())
+			}
+		}
+	default:
+		usage(ctx, "xdcc")
+	}
 }
 
 func scriptCmd(ctx *commandContext, args ...string) {
@@ -923,22 +1376,567 @@ func themeCmd(ctx *commandContext, args ...string) {
 }
 
 func ignoreCmd(ctx *commandContext, args ...string) {
-	if ctx.chanState == nil || len(args) != 1 {
+	if len(args) == 0 {
+		list := ignoreList.List()
+		if len(list) == 0 {
+			clientMessage(ctx.tab, now(), "not ignoring anyone")
+			return
+		}
+		clientMessage(ctx.tab, now(), fmt.Sprintf("ignoring %d %s:", len(list), pluralize("mask", len(list))))
+		for i, ig := range list {
+			clientMessage(ctx.tab, fmt.Sprintf("%d. %s", i+1, ig))
+		}
 		return
 	}
 
-	nick := ctx.chanState.nickList.Get(args[0])
-	if nick == nil {
+	ig := &ignoreEntry{}
+	who := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-types":
+			if i+1 >= len(args) {
+				usage(ctx, "ignore")
+				return
+			}
+			types, err := parseIgnoreTypes(args[i+1])
+			if err != nil {
+				clientError(ctx.tab, "ERROR: "+err.Error())
+				return
+			}
+			ig.Types = types
+			i++
+		case "-for":
+			if i+1 >= len(args) {
+				usage(ctx, "ignore")
+				return
+			}
+			d, err := parseDuration(args[i+1])
+			if err != nil || d <= 0 {
+				clientError(ctx.tab, "invalid duration:", args[i+1])
+				return
+			}
+			expires := time.Now().Add(d)
+			ig.Expires = &expires
+			i++
+		case "-network":
+			if !requireServConn(ctx) {
+				return
+			}
+			ig.Network = ctx.servState.networkName
+		case "-channel":
+			if ctx.chanState == nil {
+				clientError(ctx.tab, "-channel only works in channels")
+				return
+			}
+			ig.Channel = ctx.chanState.channel
+			ig.Network = ctx.servState.networkName
+		case "-server":
+			if !requireServConn(ctx) {
+				return
+			}
+			ig.Server = true
+		default:
+			if who != "" {
+				usage(ctx, "ignore")
+				return
+			}
+			who = args[i]
+		}
+	}
+	if who == "" {
+		usage(ctx, "ignore")
 		return
 	}
 
-	ignoreList.Add(*nick)
+	host := ""
+	if ctx.chanState != nil {
+		if n := ctx.chanState.nickList.Get(who); n != nil {
+			host = n.host
+		}
+	}
+	ig.Mask = ignoreMask(who, host)
+	if ig.Server {
+		if ig.Channel != "" {
+			clientError(ctx.tab, "ERROR: the server can't ignore someone on just one channel")
+			return
+		}
+		if err := ctx.servConn.serverIgnore(ig, true); err != nil {
+			clientError(ctx.tab, "ERROR: "+err.Error())
+			return
+		}
+		if ig.Network == "" {
+			ig.Network = ctx.servState.networkName
+		}
+		ctx.servConn.serverIgnoreExpires(ig)
+	}
+	ignoreList.Add(ig)
+	clientMessage(ctx.tab, now(), "ignoring "+ig.String())
+}
+
+func highlightCmd(ctx *commandContext, args ...string) {
+	save := func(fn func(cfg *highlightConfig) bool) {
+		if err := highlights.Update(fn); err != nil {
+			clientError(ctx.tab, "ERROR: couldn't save config.json: "+err.Error())
+		}
+	}
+
+	if len(args) == 0 {
+		show := func(name string, rules *highlightRules) {
+			for _, r := range []struct {
+				kind   string
+				values []string
+			}{
+				{"words", rules.Words},
+				{"regexes", rules.Regexes},
+				{"exclude", rules.Exclude},
+				{"mute", rules.Mute},
+			} {
+				if len(r.values) > 0 {
+					clientMessage(ctx.tab, name+" "+r.kind+": "+strings.Join(r.values, ", "))
+				}
+			}
+		}
+		highlights.View(func(cfg *highlightConfig) {
+			status := "on"
+			if cfg.Disabled {
+				status = "off"
+			}
+			clientMessage(ctx.tab, now(), "highlights are "+bold(status))
+			show("all networks", &cfg.highlightRules)
+			for network, rules := range cfg.Networks {
+				show(network, rules)
+			}
+		})
+		return
+	}
+
+	switch args[0] {
+	case "on", "off":
+		save(func(cfg *highlightConfig) bool {
+			cfg.Disabled = args[0] == "off"
+			return true
+		})
+		clientMessage(ctx.tab, now(), "highlights are "+bold(args[0]))
+		return
+	case "add", "del":
+	default:
+		usage(ctx, "highlight")
+		return
+	}
+	if len(args) < 2 {
+		usage(ctx, "highlight")
+		return
+	}
+	switch args[1] {
+	case "word", "regex", "exclude", "mute":
+	default:
+		usage(ctx, "highlight")
+		return
+	}
+
+	network := ""
+	values := []string{}
+	for _, arg := range args[2:] {
+		if arg == "-network" {
+			if !requireServConn(ctx) {
+				return
+			}
+			network = ctx.servState.networkName
+			continue
+		}
+		values = append(values, arg)
+	}
+	value := strings.Join(values, " ")
+	if value == "" && args[1] == "mute" && ctx.chanState != nil {
+		value = ctx.chanState.channel
+	}
+	if value == "" {
+		usage(ctx, "highlight")
+		return
+	}
+	if args[1] == "regex" {
+		if _, err := regexp.Compile(value); err != nil {
+			clientError(ctx.tab, "ERROR: invalid regex: "+err.Error())
+			return
+		}
+	}
+
+	where := "all networks"
+	if network != "" {
+		where = network
+	}
+	// the rules are swapped for new slices rather than changed in place
+	// so nothing holding on to the old ones sees them change
+	save(func(cfg *highlightConfig) bool {
+		rules := cfg.rules(network, args[0] == "add")
+		if rules == nil {
+			clientError(ctx.tab, "no highlight rules for "+network)
+			return false
+		}
+		var list *[]string
+		switch args[1] {
+		case "word":
+			list = &rules.Words
+		case "regex":
+			list = &rules.Regexes
+		case "exclude":
+			list = &rules.Exclude
+		case "mute":
+			list = &rules.Mute
+		}
+
+		if args[0] == "add" {
+			*list = append(append([]string{}, *list...), value)
+			clientMessage(ctx.tab, now(), "added highlight "+args[1]+" "+bold(value)+" for "+where)
+			return true
+		}
+		keep := []string{}
+		for _, v := range *list {
+			if !strings.EqualFold(v, value) {
+				keep = append(keep, v)
+			}
+		}
+		if len(keep) == len(*list) {
+			clientError(ctx.tab, "no highlight "+args[1]+" "+value+" for "+where)
+			return false
+		}
+		*list = keep
+		clientMessage(ctx.tab, now(), "removed highlight "+args[1]+" "+bold(value)+" for "+where)
+		return true
+	})
 }
 
 func unignoreCmd(ctx *commandContext, args ...string) {
 	if len(args) != 1 {
+		usage(ctx, "unignore")
+		return
+	}
+
+	// by number from /ignore, mask or nick
+	var target *ignoreEntry
+	if n, err := strconv.Atoi(args[0]); err == nil {
+		list := ignoreList.List()
+		if n < 1 || n > len(list) {
+			clientError(ctx.tab, "ERROR: no ignore #"+args[0])
+			return
+		}
+		target = list[n-1]
+	}
+	host := ""
+	if ctx.chanState != nil {
+		if n := ctx.chanState.nickList.Get(args[0]); n != nil {
+			host = n.host
+		}
+	}
+	mask := ignoreMask(args[0], host)
+	removed := ignoreList.Remove(func(ig *ignoreEntry) bool {
+		if target != nil {
+			return ig == target
+		}
+		return strings.EqualFold(ig.Mask, args[0]) || strings.EqualFold(ig.Mask, mask) ||
+			strings.EqualFold(ig.Mask, args[0]+"!*@*")
+	})
+	if len(removed) == 0 {
+		clientError(ctx.tab, "not ignoring "+args[0])
+		return
+	}
+	for _, ig := range removed {
+		if ig.Server && ctx.servConn != nil && ctx.servState.connState == CONNECTED && strings.EqualFold(ig.Network, ctx.servState.networkName) {
+			if err := ctx.servConn.serverIgnore(ig, false); err != nil {
+				clientError(ctx.tab, "ERROR: "+err.Error())
+			}
+		}
+		clientMessage(ctx.tab, now(), "no longer ignoring "+ig.String())
+	}
+}
+
+func acceptCmd(ctx *commandContext, args ...string) {
+	if !requireServConn(ctx) {
+		return
+	}
+	if ctx.servConn.callerIDMode() == 0 {
+		clientError(ctx.tab, "ERROR: this server doesn't support CALLERID")
+		return
+	}
+	if len(args) == 0 {
+		ctx.servConn.conn.Raw("ACCEPT *")
+		return
+	}
+	ctx.servConn.conn.Raw("ACCEPT " + strings.Join(args, ","))
+}
+
+func callerIDCmd(ctx *commandContext, args ...string) {
+	if !requireServConn(ctx) {
+		return
+	}
+	mode := ctx.servConn.callerIDMode()
+	if mode == 0 {
+		clientError(ctx.tab, "ERROR: this server doesn't support CALLERID")
+		return
+	}
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		usage(ctx, "callerid")
+		return
+	}
+	sign := "+"
+	if args[0] == "off" {
+		sign = "-"
+	}
+	ctx.servConn.conn.Mode(ctx.servState.user.nick, sign+string(mode))
+}
+
+func filterCmd(ctx *commandContext, args ...string) {
+	update := func(fn func(filters *[]*wordFilter) bool) {
+		if err := wordFilters.Update(fn); err != nil {
+			clientError(ctx.tab, "ERROR: couldn't save config.json: "+err.Error())
+		}
+	}
+
+	if len(args) == 0 {
+		if len(clientCfg.WordFilters) == 0 {
+			clientMessage(ctx.tab, now(), "no word filters")
+			return
+		}
+		for i, f := range clientCfg.WordFilters {
+			clientMessage(ctx.tab, now(), strconv.Itoa(i+1)+". "+f.String())
+		}
+		return
+	}
+
+	switch args[0] {
+	case "del":
+		if len(args) != 2 {
+			usage(ctx, "filter")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		var f *wordFilter
+		update(func(filters *[]*wordFilter) bool {
+			if err != nil || n < 1 || n > len(*filters) {
+				return false
+			}
+			f = (*filters)[n-1]
+			*filters = append((*filters)[:n-1], (*filters)[n:]...)
+			return true
+		})
+		if f == nil {
+			clientError(ctx.tab, "ERROR: no filter #"+args[1])
+			return
+		}
+		clientMessage(ctx.tab, now(), "removed filter "+f.String())
+		return
+	case "add":
+	default:
+		usage(ctx, "filter")
 		return
 	}
 
-	ignoreList.Remove(args[0])
+	f := &wordFilter{}
+	words := []string{}
+	for _, arg := range args[1:] {
+		switch arg {
+		case "-regex":
+			f.Regex = true
+		case "-in", "-out":
+			f.Direction = arg[1:]
+		case "-channel":
+			if ctx.chanState != nil {
+				f.Channels = append(f.Channels, ctx.chanState.channel)
+			} else if ctx.pmState != nil {
+				f.Channels = append(f.Channels, ctx.pmState.nick)
+			} else {
+				clientError(ctx.tab, "ERROR: -channel can only be used in channels and private messages")
+				return
+			}
+		default:
+			words = append(words, arg)
+		}
+	}
+	if len(words) > 0 {
+		f.Pattern = words[0]
+		f.Replace = strings.Join(words[1:], " ")
+	}
+	for i, w := range words {
+		if w == "=>" {
+			f.Pattern = strings.Join(words[:i], " ")
+			f.Replace = strings.Join(words[i+1:], " ")
+			break
+		}
+	}
+	if f.Pattern == "" {
+		usage(ctx, "filter")
+		return
+	}
+	if _, _, err := f.compile(); err != nil {
+		clientError(ctx.tab, "ERROR: invalid filter: "+err.Error())
+		return
+	}
+	update(func(filters *[]*wordFilter) bool {
+		*filters = append(*filters, f)
+		return true
+	})
+	clientMessage(ctx.tab, now(), "added filter "+f.String())
+}
+
+func importCmd(ctx *commandContext, args ...string) {
+	if len(args) < 2 {
+		usage(ctx, "import")
+		return
+	}
+	importer, ok := chatLogImporters[strings.ToLower(args[0])]
+	if !ok {
+		clientError(ctx.tab, "ERROR: can't import "+args[0]+" logs, try irssi, weechat, znc or mirc")
+		return
+	}
+	network, target := "", ""
+	path := []string{}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "-network", "-channel":
+			if i+1 == len(args) {
+				usage(ctx, "import")
+				return
+			}
+			if args[i] == "-network" {
+				network = args[i+1]
+			} else {
+				target = args[i+1]
+			}
+			i++
+		default:
+			path = append(path, args[i])
+		}
+	}
+	if len(path) == 0 {
+		usage(ctx, "import")
+		return
+	}
+
+	clientMessage(ctx.tab, now(), "importing "+args[0]+" logs from "+strings.Join(path, " ")+"...")
+	go func() {
+		files, lines, skipped, err := importChatLogs(importer, strings.Join(path, " "), network, target)
+		if err != nil {
+			clientError(ctx.tab, "ERROR: import failed after "+strconv.Itoa(files)+" files: "+err.Error())
+			return
+		}
+		msg := "imported " + strconv.Itoa(lines) + " lines from " + strconv.Itoa(files) + " files"
+		if skipped > 0 {
+			msg += ", skipped " + strconv.Itoa(skipped) + " " + pluralize("day", skipped) + " that were already logged"
+		}
+		clientMessage(ctx.tab, now(), msg)
+	}()
+}
+
+// logSearchDate is a date for /grep, either 2006-01-02 or a while ago like 7d
+func logSearchDate(str string, now time.Time) (string, error) {
+	if _, err := time.Parse(chatLogDateFormat, str); err == nil {
+		return str, nil
+	}
+	d, err := parseDuration(str)
+	if err != nil {
+		return "", fmt.Errorf("%s isn't a date like 2006-01-02 or a duration like 7d", str)
+	}
+	return now.Add(-d).Format(chatLogDateFormat), nil
+}
+
+func grepCmd(ctx *commandContext, args ...string) {
+	q := &logQuery{}
+	context, max := 1, 20
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-here":
+			if ctx.servState != nil {
+				q.network = ctx.servState.networkName
+			}
+			if ctx.chanState != nil {
+				q.target = ctx.chanState.channel
+			} else if ctx.pmState != nil {
+				q.target = ctx.pmState.nick
+			}
+			continue
+		case "-network", "-channel", "-nick", "-from", "-to", "-regex", "-context", "-max":
+		default:
+			q.words = append(q.words, logWords(arg)...)
+			continue
+		}
+		if i+1 == len(args) {
+			usage(ctx, "grep")
+			return
+		}
+		i++
+		val := args[i]
+		var err error
+		switch arg {
+		case "-network":
+			q.network = val
+		case "-channel":
+			q.target = val
+		case "-nick":
+			q.nick = val
+		case "-from":
+			q.from, err = logSearchDate(val, time.Now())
+		case "-to":
+			q.to, err = logSearchDate(val, time.Now())
+		case "-regex":
+			q.regex, err = regexp.Compile(val)
+		case "-context", "-max":
+			n, e := strconv.Atoi(val)
+			if e != nil || n < 0 {
+				err = fmt.Errorf("%s needs a number", arg)
+			} else if arg == "-context" {
+				context = n
+			} else {
+				max = n
+			}
+		}
+		if err != nil {
+			clientError(ctx.tab, "ERROR: "+err.Error())
+			return
+		}
+	}
+	if len(q.words) == 0 && q.regex == nil && q.nick == "" {
+		usage(ctx, "grep")
+		return
+	}
+	if len(q.words) == 0 && q.nick == "" && q.target == "" && q.from == "" && q.to == "" {
+		// it would have to read every log there is
+		clientError(ctx.tab, "ERROR: -regex needs some words, -nick, -channel, -here or a date as well")
+		return
+	}
+
+	go func() {
+		results, total, err := grepChatLogs(q, context, max)
+		if err != nil {
+			clientError(ctx.tab, "ERROR: couldn't search chat logs: "+err.Error())
+			return
+		}
+		if total == 0 {
+			clientMessage(ctx.tab, now(), "no matches")
+			return
+		}
+		var file *logIndexFile
+		for _, r := range results {
+			if r.file != file {
+				file = r.file
+				where := file.network
+				if file.target != "" {
+					where += " " + file.target
+				}
+				clientMessage(ctx.tab, "\x02"+where+" "+file.date)
+			} else if r.gap {
+				clientMessage(ctx.tab, "  --")
+			}
+			if r.context {
+				clientMessage(ctx.tab, "  "+r.line)
+			} else {
+				clientMessage(ctx.tab, "> "+r.line)
+			}
+		}
+		if total > max && max > 0 {
+			clientMessage(ctx.tab, now(), "showing the last "+strconv.Itoa(max)+" of "+strconv.Itoa(total)+" matches, use -max to see more")
+		} else {
+			clientMessage(ctx.tab, now(), strconv.Itoa(total)+" matches")
+		}
+	}()
 }
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goirc "github.com/fluffle/goirc/client"
+)
+
+// NOTE: goirc always answers VERSION (with cfg.Version, which comes from
+// "version" in config.json) and PING by itself and there's no way to turn
+// that off, so those two aren't rate limited by us. goirc does throttle
+// everything it sends though so it's not a big deal.
+
+type ctcpConfig struct {
+	UserInfo string `json:"userinfo"`
+	Finger   string `json:"finger"`
+	Source   string `json:"source"`
+	// don't answer these at all e.g. ["TIME"] if you don't want people to
+	// know what timezone you're in
+	Disabled []string `json:"disabled"`
+}
+
+const (
+	ctcpSenderLimit = 3  // replies per sender
+	ctcpGlobalLimit = 10 // replies to everyone
+	ctcpWindow      = time.Second * 20
+)
+
+// ctcpLimiter is a sliding window rate limiter, per sender and overall
+type ctcpLimiter struct {
+	senders map[string][]time.Time
+	global  []time.Time
+	warned  map[string]bool
+	mu      *sync.Mutex
+}
+
+func newCtcpLimiter() *ctcpLimiter {
+	return &ctcpLimiter{
+		senders: map[string][]time.Time{},
+		global:  []time.Time{},
+		warned:  map[string]bool{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+func pruneTimes(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// Allow says whether we can reply to sender at t. warn is true the first
+// time sender gets refused in a window so we only complain about it once.
+func (cl *ctcpLimiter) Allow(sender string, t time.Time) (ok, warn bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	key := strings.ToLower(sender)
+	cutoff := t.Add(-ctcpWindow)
+	cl.global = pruneTimes(cl.global, cutoff)
+	times := pruneTimes(cl.senders[key], cutoff)
+	if len(times) == 0 {
+		delete(cl.senders, key)
+		delete(cl.warned, key)
+	}
+
+	if len(times) >= ctcpSenderLimit || len(cl.global) >= ctcpGlobalLimit {
+		warn = !cl.warned[key]
+		cl.warned[key] = true
+		cl.senders[key] = times
+		return false, warn
+	}
+	cl.senders[key] = append(times, t)
+	cl.global = append(cl.global, t)
+	return true, false
+}
+
+// ctcpPings remembers the /ping's we've sent so we can tell how long the
+// reply took. replies echo back whatever we sent so that's the key.
+type ctcpPings struct {
+	sent map[string]time.Time
+	mu   *sync.Mutex
+}
+
+func newCtcpPings() *ctcpPings {
+	return &ctcpPings{
+		sent: map[string]time.Time{},
+		mu:   &sync.Mutex{},
+	}
+}
+
+func (cp *ctcpPings) New() string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	t := time.Now()
+	for token, sent := range cp.sent {
+		if t.Sub(sent) > time.Minute*2 {
+			delete(cp.sent, token)
+		}
+	}
+	token := strconv.FormatInt(t.UnixNano(), 10)
+	cp.sent[token] = t
+	return token
+}
+
+// RTT returns how long ago token was sent. we don't forget about the token
+// because pinging a channel gets a reply from everyone in it.
+func (cp *ctcpPings) RTT(token string) (time.Duration, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	sent, ok := cp.sent[strings.TrimSpace(token)]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(sent), true
+}
+
+func ctcpReplies() map[string]func(arg string) string {
+	cfg := clientCfg.CTCP
+	return map[string]func(string) string{
+		"TIME": func(string) string {
+			return time.Now().Format(time.RFC1123Z)
+		},
+		"CLIENTINFO": func(string) string {
+			cmds := []string{goirc.ACTION, goirc.VERSION, goirc.PING, "DCC"}
+			for cmd := range ctcpReplies() {
+				if !ctcpDisabled(cmd) {
+					cmds = append(cmds, cmd)
+				}
+			}
+			sort.Strings(cmds)
+			return strings.Join(cmds, " ")
+		},
+		"SOURCE": func(string) string {
+			if cfg.Source != "" {
+				return cfg.Source
+			}
+			return "https://github.com/dayvonjersen/chopsuey"
+		},
+		"USERINFO": func(string) string {
+			return cfg.UserInfo
+		},
+		"FINGER": func(string) string {
+			return cfg.Finger
+		},
+	}
+}
+
+func ctcpDisabled(cmd string) bool {
+	for _, c := range clientCfg.CTCP.Disabled {
+		if strings.EqualFold(c, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+func ctcpHandler(servConn *serverConnection, servState *serverState) goirc.HandlerFunc {
+	return func(c *goirc.Conn, l *goirc.Line) {
+		cmd := strings.ToUpper(l.Args[0])
+		arg := ""
+		if len(l.Args) > 2 {
+			arg = l.Args[2]
+		}
+
+		to := ""
+		if len(l.Args) > 1 && isChannel(l.Args[1]) {
+			to = " to " + l.Args[1]
+		}
+		msg := fmt.Sprintf("CTCP %s from %s%s", cmd, l.Nick, to)
+		if arg != "" && cmd != goirc.PING {
+			msg += ": " + arg
+		}
+
+		reply, ok := ctcpReplies()[cmd]
+		if ok && !ctcpDisabled(cmd) {
+			if allow, warn := servConn.ctcpLimit.Allow(l.Nick, time.Now()); allow {
+				if text := reply(arg); text != "" {
+					c.CtcpReply(l.Nick, cmd, text)
+				}
+			} else {
+				if warn {
+					clientError(servState.tab, now(), "too many CTCP requests from "+l.Src+", not replying for a while")
+				}
+				return
+			}
+		}
+		clientMessage(servState.CurrentTab(), now(), color(msg, LightGrey))
+	}
+}
+
+func ctcpReplyHandler(servConn *serverConnection, servState *serverState) goirc.HandlerFunc {
+	return func(c *goirc.Conn, l *goirc.Line) {
+		cmd := strings.ToUpper(l.Args[0])
+		arg := ""
+		if len(l.Args) > 2 {
+			arg = l.Args[2]
+		}
+		// DCC REJECT SEND <filename>
+		if cmd == "DCC" {
+			args := splitDccArgs(arg)
+			if len(args) > 2 && strings.EqualFold(args[0], "REJECT") && strings.EqualFold(args[1], "SEND") {
+				if tr := dccTransfers.FindPending(servState, l.Nick, args[2]); tr != nil {
+					tr.Rejected()
+					return
+				}
+			}
+		}
+		if cmd == goirc.PING {
+			if rtt, ok := servConn.ctcpPing.RTT(arg); ok {
+				clientMessage(servState.CurrentTab(), now(),
+					fmt.Sprintf("PING reply from %s: %.3fs", l.Nick, rtt.Seconds()))
+				return
+			}
+		}
+		clientMessage(servState.CurrentTab(), now(), "CTCP "+cmd+" reply from "+l.Nick+": "+arg)
+	}
+}
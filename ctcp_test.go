@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCtcpLimiter(t *testing.T) {
+	cl := newCtcpLimiter()
+	start := time.Now()
+
+	for i := 0; i < ctcpSenderLimit; i++ {
+		if ok, _ := cl.Allow("flooder", start); !ok {
+			t.Fatalf("request %d should have been allowed", i+1)
+		}
+	}
+	if ok, warn := cl.Allow("FLOODER", start); ok || !warn {
+		t.Fatalf("expected refusal with warning, got ok=%v warn=%v", ok, warn)
+	}
+	if ok, warn := cl.Allow("flooder", start); ok || warn {
+		t.Fatalf("expected refusal without warning, got ok=%v warn=%v", ok, warn)
+	}
+	if ok, _ := cl.Allow("someone", start); !ok {
+		t.Fatal("other senders should be unaffected")
+	}
+	if ok, _ := cl.Allow("flooder", start.Add(ctcpWindow+time.Second)); !ok {
+		t.Fatal("flooder should be allowed again after the window")
+	}
+
+	cl = newCtcpLimiter()
+	for i := 0; i < ctcpGlobalLimit; i++ {
+		cl.Allow(string(rune('a'+i)), start)
+	}
+	if ok, _ := cl.Allow("new", start); ok {
+		t.Fatal("global limit not enforced")
+	}
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"math/rand"
 	"net"
-	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func ntohl(n int64) net.IP {
@@ -29,112 +31,463 @@ func htonl(ip net.IP) int64 {
 	return a<<24 | b<<16 | c<<8 | d
 }
 
-func wanIP() (net.IP, error) {
-	resp, err := http.Get("http://icanhazip.com")
+// routeIP returns the local address we'd use to reach addr, i.e. our end of
+// the connection to the server. dialing udp doesn't actually send anything,
+// it just asks the OS which interface it would use.
+func routeIP(addr string) (net.IP, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, nil
+	}
+	return ip, nil
+}
 
+// resolveIP parses host as an address or looks it up, preferring the same
+// family as like (since that's what the other side will be able to reach)
+func resolveIP(host string, like net.IP) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	ips, err := net.LookupIP(host)
 	if err != nil {
 		return nil, err
 	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (like.To4() != nil) {
+			return ip, nil
+		}
+	}
+	return ips[0], nil
+}
+
+// learnHost is called with whatever the server tells us our host is (001,
+// 396, WHOIS on ourselves). most of the time it's a cloak or a hostname
+// that doesn't resolve to anything public and we just ignore it.
+func (servConn *serverConnection) learnHost(host string) {
+	if host == "" {
+		return
+	}
+	go func() {
+		servConn.mu.Lock()
+		local := servConn.localIP
+		servConn.mu.Unlock()
 
-	buf := make([]byte, 16)
-	resp.Body.Read(buf)
+		ip, err := resolveIP(host, local)
+		if err != nil || !isPublicIP(ip) {
+			return
+		}
+		servConn.mu.Lock()
+		servConn.ip = ip
+		servConn.mu.Unlock()
+	}()
+}
 
-	i := 15
-	for ; buf[i] != '\n'; i-- {
+// dccAddr returns the address to listen on and the one to tell the other
+// side to connect to. these are different behind NAT, in order of
+// preference the advertised one is:
+//
+//   - "dccaddress" in config.json
+//   - what the server says our host is, if it's public
+//   - the local address of the connection to the server
+//
+// listen is always that local address
+func (servConn *serverConnection) dccAddr() (listen, advertise net.IP, err error) {
+	servConn.mu.Lock()
+	listen, advertise = servConn.localIP, servConn.ip
+	servConn.mu.Unlock()
+
+	if listen == nil {
+		listen, err = routeIP(servConn.conn.Config().Server)
+		if err != nil {
+			return nil, nil, err
+		}
+		servConn.mu.Lock()
+		servConn.localIP = listen
+		servConn.mu.Unlock()
 	}
+	if clientCfg.DccAddress != "" {
+		advertise, err = resolveIP(clientCfg.DccAddress, listen)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dccaddress: %v", err)
+		}
+	}
+	if advertise == nil {
+		advertise = listen
+	}
+	return listen, advertise, nil
+}
+
+// quoteDccFilename puts filenames with spaces in quotes, other clients
+// take everything up to the first space as the filename otherwise
+func quoteDccFilename(name string) string {
+	name = strings.Replace(name, `"`, "'", -1)
+	if strings.Contains(name, " ") {
+		return `"` + name + `"`
+	}
+	return name
+}
 
-	return net.ParseIP(string(buf[:i])), nil
+// sameDccFilename is whether a filename someone sent back to us is ours,
+// they only ever saw it after quoteDccFilename
+func sameDccFilename(ours, theirs string) bool {
+	return strings.Replace(ours, `"`, "'", -1) == strings.Replace(theirs, `"`, "'", -1)
 }
 
-func localIP() (net.IP, error) {
-	ifaceAddrs, err := net.InterfaceAddrs()
+// formatDccAddr is the opposite of parseDccAddr
+func formatDccAddr(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return strconv.FormatInt(htonl(ip4), 10)
+	}
+	return ip.String()
+}
+
+// dccListen opens a port for the other side to connect to and returns the
+// address they should use
+func dccListen(servConn *serverConnection) (net.Listener, net.IP, error) {
+	listen, advertise, err := servConn.dccAddr()
 	if err != nil {
+		return nil, nil, err
+	}
+	host := listen.String()
+	if (listen.To4() != nil) != (advertise.To4() != nil) {
+		// e.g. we're talking to the server over ipv6 but told to use ipv4
+		host = ""
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	return ln, advertise, err
+}
+
+// isPublicIP is whether someone on the internet can probably connect to ip
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified())
+}
+
+// dccUsePassive decides whether we ask the receiver to listen instead of
+// us, which is what you want behind NAT. "dccpassive" in config.json can
+// be "always", "never" or "auto" (the default). auto goes by our end of the
+// connection to the server, not the address we advertise: knowing our
+// public address doesn't mean anyone can connect to it. if you've
+// forwarded ports set it to "never". err is from dccListen.
+func dccUsePassive(servConn *serverConnection, err error) bool {
+	switch clientCfg.DccPassive {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	listen, _, err := servConn.dccAddr()
+	return err != nil || !isPublicIP(listen)
+}
+
+// dccSend offers path to nick, or queues it if we're already sending as
+// many files as "dccmaxsends" allows
+func dccSend(servConn *serverConnection, servState *serverState, nick, path string) (*dccTransfer, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	tr := &dccTransfer{
+		servConn:  servConn,
+		servState: servState,
+		nick:      nick,
+		filename:  filepath.Base(path),
+		path:      path,
+		size:      stat.Size(),
+		state:     DCC_PENDING,
+	}
+	if !dccTransfers.SendSlotFree() {
+		tr.state = DCC_QUEUED
+		dccTransfers.Add(tr)
+		return tr, nil
+	}
+	dccTransfers.Add(tr)
+	if err := tr.offer(); err != nil {
+		dccTransfers.Remove(tr)
 		return nil, err
 	}
-	for _, ifaceAddr := range ifaceAddrs {
-		ifaceIP := net.ParseIP(strings.Split(ifaceAddr.String(), "/")[0])
-		if ifaceIP != nil {
-			if ifaceIP.To4() != nil {
-				return ifaceIP.To4(), nil
+	return tr, nil
+}
+
+// offer sends DCC SEND. normally we listen and wait for them to connect,
+// with passive DCC we send port 0 and a token instead and they reply with
+// a DCC SEND of their own telling us where to connect.
+func (tr *dccTransfer) offer() error {
+	ln, ip, err := dccListen(tr.servConn)
+	if dccUsePassive(tr.servConn, err) {
+		if ln != nil {
+			ln.Close()
+		}
+		if ip == nil {
+			ip = net.IPv4zero
+		}
+		tr.mu.Lock()
+		tr.ip = ip
+		tr.token = strconv.Itoa(rand.Intn(99999) + 1)
+		tr.mu.Unlock()
+		time.AfterFunc(dccOfferTimeout, func() {
+			if state, _, _ := tr.State(); state == DCC_PENDING {
+				tr.fail(fmt.Errorf("%s didn't accept within %s", tr.nick, humanDuration(dccOfferTimeout)))
 			}
+		})
+	} else {
+		if err != nil {
+			return err
 		}
+		tr.mu.Lock()
+		tr.ip = ip
+		tr.port = ln.Addr().(*net.TCPAddr).Port
+		tr.listener = ln
+		tr.mu.Unlock()
+		go tr.send()
 	}
-	return nil, fmt.Errorf("couldn't bind to an ip4 address on the local machine")
-}
 
-func fileTransfer(servConn *serverConnection, who, filename string) {
-	f, err := os.Open(filename)
-	checkErr(err)
-	stat, err := f.Stat()
-	checkErr(err)
-	filesize := stat.Size()
+	tr.servConn.conn.Ctcp(tr.nick, "DCC", fmt.Sprintf("SEND %s %s %d %d%s",
+		quoteDccFilename(tr.filename), formatDccAddr(tr.ip), tr.port, tr.size, tr.tokenArg()))
+	return nil
+}
 
-	if servConn.ip == nil {
-		servConn.ip, _ = localIP()
+// splitDccArgs splits the text of a DCC request on spaces except inside
+// double quotes, which is how filenames with spaces are sent
+func splitDccArgs(text string) []string {
+	args := []string{}
+	arg, quoted, inArg := []rune{}, false, false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case r == ' ' && !quoted:
+			if inArg {
+				args = append(args, string(arg))
+			}
+			arg, inArg = []rune{}, false
+		default:
+			arg = append(arg, r)
+			inArg = true
+		}
 	}
-	ip := servConn.ip
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args
+}
 
-	ln, err := net.Listen("tcp", ip.String()+":0")
-	checkErr(err)
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			checkErr(err)
-			io.Copy(conn, f)
-			f.Close()
-			conn.Close()
-			return
+// parseDccAddr takes either the traditional 32-bit integer or an IP
+// address written out normally (which is what clients send for IPv6)
+func parseDccAddr(str string) (net.IP, error) {
+	if strings.ContainsAny(str, ".:") {
+		if ip := net.ParseIP(str); ip != nil {
+			return ip, nil
 		}
-	}()
-	addr := strings.Split(ln.Addr().String(), ":")
-	log.Println("listening on", addr)
+		return nil, fmt.Errorf("bad address: %s", str)
+	}
+	n, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad address: %s", str)
+	}
+	return ntohl(int64(n)), nil
+}
 
-	ipnl := htonl(ip)
+type dccOffer struct {
+	filename string
+	ip       net.IP
+	port     int
+	size     int64  // -1 if the sender didn't tell us
+	token    string // passive DCC
+}
 
-	port, _ := strconv.ParseInt(addr[1], 10, 64)
+// parseDccSend parses the arguments following DCC SEND:
+//
+//	<filename> <ip> <port> [<filesize> [<token>]]
+//
+// port is 0 for passive DCC (where they want us to listen instead) and
+// the token identifies the transfer when we tell them where to connect
+func parseDccSend(args []string) (*dccOffer, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("not enough arguments")
+	}
+	offer := &dccOffer{filename: args[0], size: -1}
+	var err error
+	offer.ip, err = parseDccAddr(args[1])
+	if err != nil {
+		return nil, err
+	}
+	offer.port, err = strconv.Atoi(args[2])
+	if err != nil || offer.port < 0 || offer.port > 65535 {
+		return nil, fmt.Errorf("bad port: %s", args[2])
+	}
+	if len(args) > 3 {
+		offer.size, err = strconv.ParseInt(args[3], 10, 64)
+		if err != nil || offer.size < 0 {
+			return nil, fmt.Errorf("bad file size: %s", args[3])
+		}
+	}
+	if len(args) > 4 {
+		offer.token = args[4]
+	}
+	if offer.port == 0 && offer.token == "" {
+		return nil, fmt.Errorf("port 0 without a token")
+	}
+	return offer, nil
+}
 
-	ctcpMsg := fmt.Sprintf("DCC SEND %s %v %v %v", filename, ipnl, port, filesize)
-	log.Println(ctcpMsg)
+// sanitizeFilename makes a filename someone sent us safe to save: no
+// directories, nothing windows won't let us create, no reserved device
+// names like CON or LPT1
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, "/\\"); i != -1 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || r == 127 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, ". ")
+	if len(name) > 200 {
+		ext := filepath.Ext(name)
+		if len(ext) > 20 {
+			ext = ""
+		}
+		name = name[:200-len(ext)] + ext
+	}
+	if name == "" {
+		return "download"
+	}
+	base := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+	switch base {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		name = "_" + name
+	}
+	return name
+}
 
-	servConn.conn.Ctcp(who, ctcpMsg)
+// dccDownloadDir is "downloaddir" from config.json or Downloads in the
+// user's home directory
+func dccDownloadDir() string {
+	if clientCfg.DownloadDir != "" {
+		return clientCfg.DownloadDir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, "Downloads")
+	}
+	return "downloads"
 }
 
-func dccHandler(servConn *serverConnection, who, req string) {
-	args := strings.Split(req, " ")
-	switch args[0] {
+func dccHandler(servConn *serverConnection, servState *serverState, nick, host, text string) {
+	args := splitDccArgs(text)
+	if len(args) == 0 {
+		return
+	}
+	switch strings.ToUpper(args[0]) {
 	case "SEND":
-		filename := args[1]
-		ipnl, _ := strconv.ParseInt(args[2], 10, 64)
-		ip := ntohl(ipnl)
-		port, _ := strconv.Atoi(args[3])
-		filesize, _ := strconv.Atoi(args[4])
-
-		log.Println("got DCC SEND from", who, ":", filename, ip, port, filesize)
-
-		servConn.conn.Ctcp(who, "DCC ACCEPT", filename, fmt.Sprintf("%d", port), "0")
-		f, err := os.Create(filename)
-		checkErr(err)
-		defer f.Close()
-
-		conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", ip, port))
-		checkErr(err)
-
-		size := 0
-		for {
-			b := make([]byte, 32)
-			n, err := conn.Read(b)
-			size += n
-			if err == io.EOF || size >= filesize {
-				conn.Close()
-				break
-			} else if err != nil {
-				log.Println(err)
-				break
+		offer, err := parseDccSend(args[1:])
+		if err != nil {
+			clientError(servState.CurrentTab(), now(), "invalid DCC SEND from "+nick+": "+err.Error())
+			return
+		}
+		if offer.token != "" && offer.port != 0 {
+			// they accepted one of our passive offers
+			if tr := dccTransfers.FindOffer(servState, nick, 0, offer.token, false, DCC_PENDING); tr != nil {
+				go tr.Connect(offer.ip, offer.port)
+				return
+			}
+		}
+		tr := dccTransfers.Add(&dccTransfer{
+			servConn:  servConn,
+			servState: servState,
+			nick:      nick,
+			host:      host,
+			incoming:  true,
+			offered:   offer.filename,
+			filename:  sanitizeFilename(offer.filename),
+			ip:        offer.ip,
+			port:      offer.port,
+			size:      offer.size,
+			token:     offer.token,
+			state:     DCC_PENDING,
+		})
+		size := "unknown size"
+		if tr.size >= 0 {
+			size = humanSize(tr.size)
+		}
+		dest := []tabWithTextBuffer{servState.CurrentTab()}
+		if dest[0].Index() != servState.tab.Index() {
+			dest = append(dest, servState.tab)
+		}
+		rule, reason := dccCheckOffer(nick+"!"+host, tr.filename, tr.size, dccBlockedExtensions(), dccMaxSize(), clientCfg.DccAutoAccept)
+		if servConn.xdcc.Offered(tr) && rule == DCC_RULE_ASK {
+			// we asked for it
+			rule = DCC_RULE_ACCEPT
+		}
+		switch rule {
+		case DCC_RULE_REJECT:
+			tr.decline(errors.New(reason))
+			Println(CLIENT_MESSAGE, dest, now(), color(fmt.Sprintf("declined %s (%s) from %s: %s", tr.filename, size, nick, reason), LightGrey))
+			servState.refreshTransfers()
+			return
+		case DCC_RULE_ACCEPT:
+			Println(CLIENT_MESSAGE, dest, now(), fmt.Sprintf("accepting %s (%s) from %s", bold(tr.filename), size, nick))
+			if err := tr.Accept(); err != nil {
+				clientError(servState.CurrentTab(), now(), "DCC #"+strconv.Itoa(tr.id)+": "+err.Error())
+			}
+		default:
+			Println(CLIENT_MESSAGE, dest, now(), fmt.Sprintf("%s wants to send you %s (%s)", nick, bold(tr.filename), size))
+			Println(CLIENT_MESSAGE, dest, color(fmt.Sprintf("type /dcc accept %d or /dcc decline %d", tr.id, tr.id), LightGrey))
+		}
+		servState.Transfers(servConn).Refresh()
+	case "CHAT":
+		dccChatHandler(servConn, servState, nick, args[1:])
+	case "RESUME", "ACCEPT":
+		// <filename> <port> <position> [<token>]
+		if len(args) < 4 {
+			clientError(servState.CurrentTab(), now(), "invalid DCC "+args[0]+" from "+nick)
+			return
+		}
+		port, err1 := strconv.Atoi(args[2])
+		position, err2 := strconv.ParseInt(args[3], 10, 64)
+		if err1 != nil || err2 != nil {
+			clientError(servState.CurrentTab(), now(), "invalid DCC "+args[0]+" from "+nick+": "+text)
+			return
+		}
+		token := ""
+		if len(args) > 4 {
+			token = args[4]
+		}
+		if strings.ToUpper(args[0]) == "RESUME" {
+			tr := dccTransfers.FindOffer(servState, nick, port, token, false, DCC_PENDING)
+			if tr == nil {
+				clientError(servState.CurrentTab(), now(), nick+" wants to resume a transfer we don't know about: "+args[1])
+				return
+			}
+			if err := tr.ResumeRequested(position); err != nil {
+				clientError(servState.CurrentTab(), now(), "DCC #"+strconv.Itoa(tr.id)+": "+err.Error())
+			}
+		} else {
+			if tr := dccTransfers.FindOffer(servState, nick, port, token, true, DCC_RESUMING); tr != nil {
+				tr.Resumed(position)
 			}
 		}
-		log.Println(filesize, size, err)
-		log.Println(filename, ": file transfer complete")
 	default:
-		log.Println("got DCC request but did not process:", req)
+		log.Println("got DCC request but did not process:", text)
+		clientMessage(servState.CurrentTab(), now(), "unsupported DCC request from "+nick+": "+text)
 	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSplitDccArgs(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		args []string
+	}{
+		{"SEND file.txt 2130706433 1024 5", []string{"SEND", "file.txt", "2130706433", "1024", "5"}},
+		{`SEND "my file.txt" 2130706433 1024 5`, []string{"SEND", "my file.txt", "2130706433", "1024", "5"}},
+		{`SEND "" 1 2`, []string{"SEND", "", "1", "2"}},
+		{"  SEND  a  ", []string{"SEND", "a"}},
+	} {
+		if args := splitDccArgs(test.text); !reflect.DeepEqual(args, test.args) {
+			t.Errorf("splitDccArgs(%q): expected %q got %q", test.text, test.args, args)
+		}
+	}
+}
+
+func TestSameDccFilename(t *testing.T) {
+	for _, test := range []struct {
+		ours, theirs string // theirs is how it comes back on the wire
+		same         bool
+	}{
+		{"file.txt", "file.txt", true},
+		{`my "file".txt`, `"my 'file'.txt"`, true},
+		{`"quoted"`, "'quoted'", true},
+		{"file.txt", "other.txt", false},
+	} {
+		theirs := splitDccArgs(test.theirs)[0]
+		if same := sameDccFilename(test.ours, theirs); same != test.same {
+			t.Errorf("sameDccFilename(%q, %q): expected %v got %v", test.ours, theirs, test.same, same)
+		}
+	}
+}
+
+func TestParseDccSend(t *testing.T) {
+	for _, test := range []struct {
+		args  []string
+		ip    string
+		port  int
+		size  int64
+		token string
+		err   bool
+	}{
+		{[]string{"a.txt", "2130706433", "1024", "5"}, "127.0.0.1", 1024, 5, "", false},
+		{[]string{"a.txt", "2130706433", "1024"}, "127.0.0.1", 1024, -1, "", false},
+		{[]string{"a.txt", "::1", "1024", "5"}, "::1", 1024, 5, "", false},
+		{[]string{"a.txt", "2130706433", "0", "5", "123"}, "127.0.0.1", 0, 5, "123", false},
+		{[]string{"a.txt", "2130706433", "0", "5"}, "", 0, 0, "", true},
+		{[]string{"a.txt", "localhost", "1024", "5"}, "", 0, 0, "", true},
+		{[]string{"a.txt", "2130706433", "99999", "5"}, "", 0, 0, "", true},
+		{[]string{"a.txt", "2130706433", "1024", "-5"}, "", 0, 0, "", true},
+		{[]string{"a.txt", "2130706433"}, "", 0, 0, "", true},
+	} {
+		offer, err := parseDccSend(test.args)
+		if (err != nil) != test.err {
+			t.Errorf("parseDccSend(%q): expected err: %v got %v", test.args, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !offer.ip.Equal(net.ParseIP(test.ip)) || offer.port != test.port || offer.size != test.size || offer.token != test.token {
+			t.Errorf("parseDccSend(%q): expected %s %d %d %q got %s %d %d %q", test.args,
+				test.ip, test.port, test.size, test.token, offer.ip, offer.port, offer.size, offer.token)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	for _, test := range []struct {
+		name, expected string
+	}{
+		{"file.txt", "file.txt"},
+		{"../../../etc/passwd", "passwd"},
+		{`..\..\windows\system32\evil.dll`, "evil.dll"},
+		{"what?.txt", "what_.txt"},
+		{"...", "download"},
+		{"", "download"},
+		{"con.txt", "_con.txt"},
+		{"LPT1", "_LPT1"},
+		{" spaces. ", "spaces"},
+		{"tab\there", "tab_here"},
+	} {
+		if name := sanitizeFilename(test.name); name != test.expected {
+			t.Errorf("sanitizeFilename(%q): expected %q got %q", test.name, test.expected, name)
+		}
+	}
+}
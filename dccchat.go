@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DCC CHAT is a plain line based TCP connection between two clients so the
+// server never sees what's said. /me is sent as CTCP ACTION like usual.
+//
+//	DCC CHAT chat <ip> <port> [<token>]
+//
+// as with SEND, port 0 and a token means passive: whoever accepts listens
+// and replies with their own DCC CHAT with the same token.
+type dccChat struct {
+	servConn  *serverConnection
+	servState *serverState
+
+	nick     string
+	incoming bool
+
+	ip    net.IP
+	port  int
+	token string
+
+	state    int
+	conn     net.Conn
+	listener net.Listener
+	tab      *tabDccChat
+	mu       *sync.Mutex
+}
+
+func (chat *dccChat) Connected() bool {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	return chat.state == DCC_ACTIVE
+}
+
+func (chat *dccChat) notify(msg string) {
+	dest := []tabWithTextBuffer{chat.servState.CurrentTab()}
+	if chat.tab != nil {
+		dest = []tabWithTextBuffer{chat.tab}
+	} else if dest[0].Index() != chat.servState.tab.Index() {
+		dest = append(dest, chat.servState.tab)
+	}
+	Println(CLIENT_MESSAGE, dest, now(), msg)
+}
+
+func (chat *dccChat) fail(err error) {
+	chat.mu.Lock()
+	if chat.state >= DCC_DONE {
+		chat.mu.Unlock()
+		return
+	}
+	chat.state = DCC_FAILED
+	chat.mu.Unlock()
+	chat.notify(color("DCC CHAT with "+chat.nick+" failed: "+err.Error(), Red))
+	if chat.tab != nil {
+		chat.tab.Update(chat.servState)
+	}
+}
+
+// dccChatOffer asks nick to DCC CHAT with us
+func dccChatOffer(servConn *serverConnection, servState *serverState, nick string) (*dccChat, error) {
+	chat := &dccChat{
+		servConn:  servConn,
+		servState: servState,
+		nick:      nick,
+		state:     DCC_PENDING,
+		mu:        &sync.Mutex{},
+	}
+
+	ln, ip, err := dccListen(servConn)
+	if dccUsePassive(servConn, err) {
+		if ln != nil {
+			ln.Close()
+		}
+		chat.ip = ip
+		if chat.ip == nil {
+			chat.ip = net.IPv4zero
+		}
+		chat.token = strconv.Itoa(rand.Intn(99999) + 1)
+		time.AfterFunc(dccOfferTimeout, func() {
+			chat.mu.Lock()
+			pending := chat.state == DCC_PENDING
+			chat.mu.Unlock()
+			if pending {
+				chat.fail(fmt.Errorf("%s didn't accept within %s", nick, humanDuration(dccOfferTimeout)))
+			}
+		})
+	} else {
+		if err != nil {
+			return nil, err
+		}
+		chat.ip = ip
+		chat.port = ln.Addr().(*net.TCPAddr).Port
+		chat.listener = ln
+		go func() {
+			ln.(*net.TCPListener).SetDeadline(time.Now().Add(dccOfferTimeout))
+			conn, err := ln.Accept()
+			ln.Close()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					err = fmt.Errorf("%s didn't accept within %s", nick, humanDuration(dccOfferTimeout))
+				}
+				chat.fail(err)
+				return
+			}
+			chat.run(conn)
+		}()
+	}
+	dccChats.Add(chat)
+
+	servConn.conn.Ctcp(nick, "DCC", fmt.Sprintf("CHAT chat %s %d%s", formatDccAddr(chat.ip), chat.port, chat.tokenArg()))
+	return chat, nil
+}
+
+func (chat *dccChat) tokenArg() string {
+	if chat.token != "" {
+		return " " + chat.token
+	}
+	return ""
+}
+
+// dccChatHandler handles DCC CHAT chat <ip> <port> [<token>]
+func dccChatHandler(servConn *serverConnection, servState *serverState, nick string, args []string) {
+	if len(args) < 3 {
+		clientError(servState.CurrentTab(), now(), "invalid DCC CHAT from "+nick)
+		return
+	}
+	ip, err := parseDccAddr(args[1])
+	port, err2 := strconv.Atoi(args[2])
+	if err != nil || err2 != nil || port < 0 || port > 65535 {
+		clientError(servState.CurrentTab(), now(), "invalid DCC CHAT from "+nick+": "+strings.Join(args, " "))
+		return
+	}
+	token := ""
+	if len(args) > 3 {
+		token = args[3]
+	}
+	if port == 0 && token == "" {
+		clientError(servState.CurrentTab(), now(), "invalid DCC CHAT from "+nick+": port 0 without a token")
+		return
+	}
+
+	if token != "" && port != 0 {
+		// they accepted our passive offer
+		if chat := dccChats.Find(servState, nick, false, DCC_PENDING); chat != nil && chat.token == token {
+			chat.mu.Lock()
+			chat.state = DCC_CONNECTING
+			chat.mu.Unlock()
+			go chat.connect(ip, port)
+			return
+		}
+	}
+
+	dccChats.Add(&dccChat{
+		servConn:  servConn,
+		servState: servState,
+		nick:      nick,
+		incoming:  true,
+		ip:        ip,
+		port:      port,
+		token:     token,
+		state:     DCC_PENDING,
+		mu:        &sync.Mutex{},
+	})
+	dest := []tabWithTextBuffer{servState.CurrentTab()}
+	if dest[0].Index() != servState.tab.Index() {
+		dest = append(dest, servState.tab)
+	}
+	Println(CLIENT_MESSAGE, dest, now(), nick+" wants to DCC CHAT with you")
+	Println(CLIENT_MESSAGE, dest, color("type /dcc chat "+nick+" to accept", LightGrey))
+}
+
+// Accept connects to an offered chat, or listens for passive ones
+func (chat *dccChat) Accept() {
+	chat.mu.Lock()
+	if chat.state != DCC_PENDING {
+		chat.mu.Unlock()
+		return
+	}
+	chat.state = DCC_CONNECTING
+	chat.mu.Unlock()
+
+	if chat.token == "" {
+		go chat.connect(chat.ip, chat.port)
+		return
+	}
+	ln, ip, err := dccListen(chat.servConn)
+	if err != nil {
+		chat.fail(err)
+		return
+	}
+	chat.mu.Lock()
+	chat.listener = ln
+	chat.mu.Unlock()
+	port := ln.Addr().(*net.TCPAddr).Port
+	chat.servConn.conn.Ctcp(chat.nick, "DCC", fmt.Sprintf("CHAT chat %s %d %s", formatDccAddr(ip), port, chat.token))
+	go func() {
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(dccConnectTimeout))
+		conn, err := ln.Accept()
+		ln.Close()
+		if err != nil {
+			chat.fail(err)
+			return
+		}
+		chat.run(conn)
+	}()
+}
+
+func (chat *dccChat) connect(ip net.IP, port int) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)), dccConnectTimeout)
+	if err != nil {
+		chat.fail(err)
+		return
+	}
+	chat.run(conn)
+}
+
+func (chat *dccChat) run(conn net.Conn) {
+	defer conn.Close()
+
+	chat.mu.Lock()
+	if chat.state >= DCC_DONE {
+		chat.mu.Unlock()
+		return
+	}
+	chat.conn = conn
+	chat.state = DCC_ACTIVE
+	chat.mu.Unlock()
+
+	// reuse the tab from an earlier chat with them if it's still open
+	if old := dccChats.FindTab(chat.servState, chat.nick); old != nil && old != chat {
+		chat.tab = old.tab
+		old.tab = nil
+		dccChats.Remove(old)
+		chat.tab.chat = chat
+	}
+	if chat.tab == nil {
+		chat.tab = newDccChatTab(chat.servConn, chat.servState, chat)
+	}
+	chat.tab.Update(chat.servState)
+	chat.notify("DCC CHAT with " + chat.nick + " established (" + conn.RemoteAddr().String() + ")")
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "\x01ACTION ") {
+			line = strings.TrimSuffix(line[8:], "\x01")
+			actionMessage(chat.tab, chat.nick, wordFilters.Apply(FILTER_IN, chat.nick, line))
+		} else {
+			privateMessage(chat.tab, chat.nick, wordFilters.Apply(FILTER_IN, chat.nick, line))
+		}
+	}
+
+	chat.mu.Lock()
+	closed := chat.state != DCC_ACTIVE
+	chat.state = DCC_DONE
+	chat.mu.Unlock()
+	if !closed {
+		msg := chat.nick + " closed the DCC CHAT"
+		if err := scanner.Err(); err != nil {
+			msg = "DCC CHAT with " + chat.nick + " lost: " + err.Error()
+		}
+		chat.notify(msg)
+	}
+	if chat.tab != nil {
+		chat.tab.Update(chat.servState)
+	}
+}
+
+func (chat *dccChat) write(line string) error {
+	chat.mu.Lock()
+	conn := chat.conn
+	active := chat.state == DCC_ACTIVE
+	chat.mu.Unlock()
+	if !active {
+		return fmt.Errorf("DCC CHAT with %s isn't connected", chat.nick)
+	}
+	conn.SetWriteDeadline(time.Now().Add(dccIdleTimeout))
+	_, err := conn.Write([]byte(line + "\n"))
+	return err
+}
+
+func (chat *dccChat) Send(msg string) error {
+	return chat.write(msg)
+}
+
+func (chat *dccChat) Action(msg string) error {
+	return chat.write("\x01ACTION " + msg + "\x01")
+}
+
+// Close hangs up
+func (chat *dccChat) Close() {
+	chat.mu.Lock()
+	wasActive := chat.state == DCC_ACTIVE
+	if chat.state < DCC_DONE {
+		chat.state = DCC_CANCELLED
+	}
+	conn, ln := chat.conn, chat.listener
+	chat.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	if ln != nil {
+		ln.Close()
+	}
+	if wasActive {
+		chat.notify("closed DCC CHAT with " + chat.nick)
+	}
+}
+
+type dccChatList struct {
+	chats []*dccChat
+	mu    *sync.Mutex
+}
+
+var dccChats = &dccChatList{
+	chats: []*dccChat{},
+	mu:    &sync.Mutex{},
+}
+
+func (cl *dccChatList) Add(chat *dccChat) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.chats = append(cl.chats, chat)
+}
+
+func (cl *dccChatList) Remove(chat *dccChat) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for i, c := range cl.chats {
+		if c == chat {
+			cl.chats = append(cl.chats[0:i], cl.chats[i+1:]...)
+			return
+		}
+	}
+}
+
+// Find returns the latest chat with nick in state
+func (cl *dccChatList) Find(servState *serverState, nick string, incoming bool, state int) *dccChat {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for i := len(cl.chats) - 1; i >= 0; i-- {
+		chat := cl.chats[i]
+		if chat.servState == servState && chat.incoming == incoming && strings.EqualFold(chat.nick, nick) {
+			chat.mu.Lock()
+			s := chat.state
+			chat.mu.Unlock()
+			if s == state {
+				return chat
+			}
+		}
+	}
+	return nil
+}
+
+// FindTab returns the chat with nick that has a tab open
+func (cl *dccChatList) FindTab(servState *serverState, nick string) *dccChat {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for _, chat := range cl.chats {
+		if chat.servState == servState && strings.EqualFold(chat.nick, nick) && chat.tab != nil {
+			return chat
+		}
+	}
+	return nil
+}
+
+// ForServer returns every chat on a server, used when we /quit
+func (cl *dccChatList) ForServer(servState *serverState) []*dccChat {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	ret := []*dccChat{}
+	for _, chat := range cl.chats {
+		if chat.servState == servState {
+			ret = append(ret, chat)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket: you can go up to a second's worth over
+// and then have to wait for it to catch up
+type rateLimiter struct {
+	rate   int64 // bytes per second, 0 is unlimited
+	tokens float64
+	last   time.Time
+	mu     *sync.Mutex
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: float64(rate), mu: &sync.Mutex{}}
+}
+
+func (rl *rateLimiter) Rate() int64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.rate
+}
+
+func (rl *rateLimiter) SetRate(rate int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = rate
+	rl.tokens = float64(rate)
+}
+
+// Take uses up n bytes at t and returns how long to wait before carrying on
+func (rl *rateLimiter) Take(n int, t time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.rate <= 0 {
+		return 0
+	}
+	if !rl.last.IsZero() {
+		rl.tokens += t.Sub(rl.last).Seconds() * float64(rl.rate)
+		if rl.tokens > float64(rl.rate) {
+			rl.tokens = float64(rl.rate)
+		}
+	}
+	rl.last = t
+	rl.tokens -= float64(n)
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / float64(rl.rate) * float64(time.Second))
+}
+
+// dccBandwidth is shared by every transfer, "dccrate" in config.json which
+// gets set once it's loaded. each transfer gets its own limit from
+// "dcctransferrate" as well.
+var dccBandwidth = newRateLimiter(0)
+
+func dccConfigRate(str string) int64 {
+	if str == "" {
+		return 0
+	}
+	rate, err := parseSize(str)
+	if err != nil {
+		return 0
+	}
+	return rate
+}
+
+// throttle waits until we're allowed to carry on after moving n bytes
+func (tr *dccTransfer) throttle(n int) {
+	t := time.Now()
+	wait := dccBandwidth.Take(n, t)
+	if d := tr.rate.Take(n, t); d > wait {
+		wait = d
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// readSize is how much to read at a time so a slow rate doesn't come out
+// in big bursts
+func (tr *dccTransfer) readSize() int {
+	n := int64(dccBufferSize)
+	for _, rate := range []int64{dccBandwidth.Rate(), tr.rate.Rate()} {
+		if rate > 0 && rate/4 < n {
+			n = rate / 4
+		}
+	}
+	if n < 512 {
+		n = 512
+	}
+	return int(n)
+}
+
+// Sending is how many of our offers are waiting to be accepted or going
+func (dl *dccTransferList) Sending() int {
+	n := 0
+	for _, tr := range dl.List() {
+		if state, _, _ := tr.State(); !tr.incoming && state > DCC_QUEUED && state < DCC_DONE {
+			n++
+		}
+	}
+	return n
+}
+
+// SendSlotFree is whether "dccmaxsends" lets us offer another file now
+func (dl *dccTransferList) SendSlotFree() bool {
+	return clientCfg.DccMaxSends <= 0 || dl.Sending() < clientCfg.DccMaxSends
+}
+
+// StartQueued offers as many queued files as there are free slots, oldest
+// first. called whenever one of ours finishes.
+func (dl *dccTransferList) StartQueued() {
+	dl.queueMu.Lock()
+	sending := 0
+	queued := []*dccTransfer{}
+	for _, tr := range dl.List() {
+		if tr.incoming {
+			continue
+		}
+		state, _, _ := tr.State()
+		if state == DCC_QUEUED {
+			queued = append(queued, tr)
+		} else if state < DCC_DONE {
+			sending++
+		}
+	}
+	start := []*dccTransfer{}
+	for _, tr := range queued {
+		if clientCfg.DccMaxSends > 0 && sending >= clientCfg.DccMaxSends {
+			break
+		}
+		tr.mu.Lock()
+		if tr.state == DCC_QUEUED {
+			tr.state = DCC_PENDING
+			start = append(start, tr)
+			sending++
+		}
+		tr.mu.Unlock()
+	}
+	dl.queueMu.Unlock()
+
+	for _, tr := range start {
+		if err := tr.offer(); err != nil {
+			tr.fail(err)
+			continue
+		}
+		tr.notify(fmt.Sprintf("offering %s (%s) to %s...", tr.filename, humanSize(tr.size), tr.nick))
+		tr.servState.refreshTransfers()
+	}
+}
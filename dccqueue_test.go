@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Now()
+	rl := newRateLimiter(1000)
+	for _, test := range []struct {
+		n    int
+		at   time.Duration
+		wait time.Duration
+	}{
+		{500, 0, 0},                      // half the burst
+		{500, 0, 0},                      // the other half
+		{500, 0, time.Millisecond * 500}, // over by 500 bytes
+		{1000, time.Second, time.Millisecond * 500}, // caught up 1000, still 500 behind
+		{100, time.Second * 10, 0},                  // plenty of time, capped at a second's worth
+		{1000, time.Second * 10, time.Millisecond * 100},
+	} {
+		if wait := rl.Take(test.n, start.Add(test.at)); wait != test.wait {
+			t.Errorf("Take(%d) at %v: expected to wait %v got %v", test.n, test.at, test.wait, wait)
+		}
+	}
+
+	unlimited := newRateLimiter(0)
+	if wait := unlimited.Take(1<<30, start); wait != 0 {
+		t.Errorf("unlimited: expected no wait got %v", wait)
+	}
+}
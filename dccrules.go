@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DCC_RULE_ASK = iota
+	DCC_RULE_ACCEPT
+	DCC_RULE_REJECT
+)
+
+// used when "dccblockedextensions" isn't in config.json at all, set it to
+// [] to allow everything
+var dccDefaultBlockedExtensions = []string{
+	".exe", ".scr", ".bat", ".cmd", ".com", ".pif", ".vbs", ".js", ".jse",
+	".wsf", ".msi", ".lnk", ".hta", ".ps1", ".reg", ".jar",
+}
+
+func dccBlockedExtensions() []string {
+	if clientCfg.DccBlockedExtensions == nil {
+		return dccDefaultBlockedExtensions
+	}
+	return clientCfg.DccBlockedExtensions
+}
+
+// dccMaxSize is "dccmaxsize" from config.json, 0 means no limit
+func dccMaxSize() int64 {
+	if clientCfg.DccMaxSize == "" {
+		return 0
+	}
+	n, err := parseSize(clientCfg.DccMaxSize)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// dccCheckOffer decides what to do with an incoming file before anyone is
+// asked about it. blocked extensions and files that are too big are turned
+// down even from people in "dccautoaccept".
+func dccCheckOffer(src, filename string, size int64, blocked []string, maxSize int64, trusted []string) (rule int, reason string) {
+	// "file.exe." and "file.exe " are the same thing as far as windows is
+	// concerned
+	ext := strings.ToLower(filepath.Ext(strings.TrimRight(filename, ". ")))
+	for _, b := range blocked {
+		b = strings.ToLower(b)
+		if !strings.HasPrefix(b, ".") {
+			b = "." + b
+		}
+		if ext == b {
+			return DCC_RULE_REJECT, ext + " files are blocked"
+		}
+	}
+	if maxSize > 0 && size > maxSize {
+		return DCC_RULE_REJECT, fmt.Sprintf("bigger than the %s limit", humanSize(maxSize))
+	}
+	for _, mask := range trusted {
+		if matchMask(strings.ToLower(mask), strings.ToLower(src)) {
+			if maxSize > 0 && size < 0 {
+				// can't auto-accept something we don't know the size of
+				// but receive() still stops it at maxSize if you accept
+				return DCC_RULE_ASK, ""
+			}
+			return DCC_RULE_ACCEPT, ""
+		}
+	}
+	return DCC_RULE_ASK, ""
+}
+
+// dccSafePath joins dir and name and makes sure the result is actually
+// inside dir, whatever name might have in it
+func dccSafePath(dir, name string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if filepath.Dir(path) != dir {
+		return "", fmt.Errorf("%q isn't a valid filename", name)
+	}
+	return path, nil
+}
+
+// dccUniquePath picks "file (1).txt", "file (2).txt"... if name is taken
+// and creates it so nothing else can take it in the meantime
+func dccUniquePath(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; i < 1000; i++ {
+		try := name
+		if i > 0 {
+			try = base + " (" + strconv.Itoa(i) + ")" + ext
+		}
+		path, err := dccSafePath(dir, try)
+		if err != nil {
+			return "", err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+		return path, nil
+	}
+	return "", fmt.Errorf("too many files called %s already", name)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDccCheckOffer(t *testing.T) {
+	blocked := []string{".exe", "scr", ".BAT"}
+	trusted := []string{"friend!*@*", "*!*@trusted.example.org"}
+	for _, test := range []struct {
+		src, filename string
+		size, max     int64
+		rule          int
+	}{
+		{"someone!u@host", "song.mp3", 100, 0, DCC_RULE_ASK},
+		{"friend!u@host", "song.mp3", 100, 0, DCC_RULE_ACCEPT},
+		{"FRIEND!u@host", "song.mp3", 100, 0, DCC_RULE_ACCEPT},
+		{"other!u@trusted.example.org", "song.mp3", 100, 0, DCC_RULE_ACCEPT},
+		{"friend!u@host", "setup.exe", 100, 0, DCC_RULE_REJECT},
+		{"someone!u@host", "SETUP.EXE", 100, 0, DCC_RULE_REJECT},
+		{"someone!u@host", "screen.scr", 100, 0, DCC_RULE_REJECT},
+		{"someone!u@host", "run.bat.", 100, 0, DCC_RULE_REJECT},
+		{"someone!u@host", "exe", 100, 0, DCC_RULE_ASK},
+		{"friend!u@host", "big.iso", 2000, 1000, DCC_RULE_REJECT},
+		{"friend!u@host", "small.iso", 1000, 1000, DCC_RULE_ACCEPT},
+		{"friend!u@host", "unknown.iso", -1, 1000, DCC_RULE_ASK},
+	} {
+		if rule, reason := dccCheckOffer(test.src, test.filename, test.size, blocked, test.max, trusted); rule != test.rule {
+			t.Errorf("dccCheckOffer(%q, %q, %d): expected %d got %d (%s)", test.src, test.filename, test.size, test.rule, rule, reason)
+		}
+	}
+}
+
+func TestDccUniquePath(t *testing.T) {
+	dir, err := os.MkdirTemp("", "dcc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, expected := range []string{"file.txt", "file (1).txt", "file (2).txt"} {
+		path, err := dccUniquePath(dir, "file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(path) != expected {
+			t.Errorf("dccUniquePath: expected %s got %s", expected, filepath.Base(path))
+		}
+	}
+
+	for _, name := range []string{"../file.txt", "a/../../file.txt", ".."} {
+		if path, err := dccSafePath(dir, name); err == nil {
+			t.Errorf("dccSafePath(%q): expected error got %s", name, path)
+		}
+	}
+}
@@ -0,0 +1,788 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DCC_NONE = iota // never set, shouldn't happen
+	DCC_QUEUED
+	DCC_PENDING
+	DCC_RESUMING
+	DCC_CONNECTING
+	DCC_ACTIVE
+	DCC_DONE
+	DCC_FAILED
+	DCC_DECLINED
+	DCC_CANCELLED
+)
+
+const (
+	dccConnectTimeout = time.Second * 30
+	dccIdleTimeout    = time.Minute * 2
+	dccBufferSize     = 32 * 1024
+	dccOfferTimeout   = time.Minute * 3
+	dccResumeTimeout  = time.Second * 30
+)
+
+func dccStateString(state int) string {
+	switch state {
+	case DCC_QUEUED:
+		return "queued"
+	case DCC_PENDING:
+		return "waiting"
+	case DCC_RESUMING:
+		return "resuming"
+	case DCC_CONNECTING:
+		return "connecting"
+	case DCC_ACTIVE:
+		return "transferring"
+	case DCC_DONE:
+		return "done"
+	case DCC_FAILED:
+		return "failed"
+	case DCC_DECLINED:
+		return "declined"
+	case DCC_CANCELLED:
+		return "cancelled"
+	}
+	return "?"
+}
+
+type dccTransfer struct {
+	id        int
+	servConn  *serverConnection
+	servState *serverState
+
+	nick, host string
+	incoming   bool
+
+	offered  string // filename as the sender gave it to us
+	filename string // what we actually call it
+	path     string
+
+	ip    net.IP
+	port  int
+	size  int64  // -1 if unknown
+	token string // passive DCC, the receiver listens instead of the sender
+
+	state       int
+	err         error
+	offset      int64 // where we resumed from
+	transferred int64
+	started     time.Time
+	finished    time.Time
+
+	rate     *rateLimiter
+	conn     net.Conn
+	listener net.Listener // outgoing only, until they connect
+	mu       *sync.Mutex
+}
+
+func (tr *dccTransfer) passive() bool {
+	return tr.token != ""
+}
+
+// tokenArg goes on the end of SEND, RESUME and ACCEPT for passive DCC
+func (tr *dccTransfer) tokenArg() string {
+	if tr.passive() {
+		return " " + tr.token
+	}
+	return ""
+}
+
+func (tr *dccTransfer) State() (state int, transferred int64, err error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.state, tr.transferred, tr.err
+}
+
+func (tr *dccTransfer) setState(state int, err error) {
+	tr.mu.Lock()
+	tr.state = state
+	tr.err = err
+	if state >= DCC_DONE {
+		tr.finished = time.Now()
+	}
+	tr.mu.Unlock()
+	tr.servState.refreshTransfers()
+	if state >= DCC_DONE && !tr.incoming {
+		go dccTransfers.StartQueued()
+	}
+	if state >= DCC_DONE && tr.incoming {
+		go tr.servConn.xdcc.Finished(tr)
+	}
+}
+
+func (tr *dccTransfer) Done() bool {
+	state, _, _ := tr.State()
+	return state >= DCC_DONE
+}
+
+// Speed is the average bytes per second so far
+func (tr *dccTransfer) Speed() int64 {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.started.IsZero() {
+		return 0
+	}
+	end := time.Now()
+	if !tr.finished.IsZero() {
+		end = tr.finished
+	}
+	secs := end.Sub(tr.started).Seconds()
+	if secs < 1 {
+		secs = 1
+	}
+	return int64(float64(tr.transferred-tr.offset) / secs)
+}
+
+// Progress is e.g. "42% (1.2 MB of 3.0 MB)"
+func (tr *dccTransfer) Progress() string {
+	_, transferred, _ := tr.State()
+	if tr.size <= 0 {
+		return humanSize(transferred)
+	}
+	return fmt.Sprintf("%d%% (%s of %s)", transferred*100/tr.size, humanSize(transferred), humanSize(tr.size))
+}
+
+func (tr *dccTransfer) Status() string {
+	state, _, err := tr.State()
+	if err != nil {
+		return dccStateString(state) + ": " + err.Error()
+	}
+	return dccStateString(state)
+}
+
+func (tr *dccTransfer) notify(msg string) {
+	dest := []tabWithTextBuffer{tr.servState.CurrentTab()}
+	if dest[0].Index() != tr.servState.tab.Index() {
+		dest = append(dest, tr.servState.tab)
+	}
+	Println(CLIENT_MESSAGE, dest, now(), fmt.Sprintf("DCC #%d: %s", tr.id, msg))
+}
+
+func (tr *dccTransfer) fail(err error) {
+	if tr.Done() {
+		// cancelled, already reported
+		return
+	}
+	tr.setState(DCC_FAILED, err)
+	if tr.incoming {
+		tr.notify(color(tr.filename+" from "+tr.nick+" failed: "+err.Error(), Red))
+	} else {
+		tr.notify(color(tr.filename+" to "+tr.nick+" failed: "+err.Error(), Red))
+	}
+}
+
+// Accept starts receiving an offered file. if we already have part of it
+// we ask the sender to resume from where we left off.
+func (tr *dccTransfer) Accept() error {
+	tr.mu.Lock()
+	if !tr.incoming || tr.state != DCC_PENDING {
+		tr.mu.Unlock()
+		return fmt.Errorf("transfer #%d isn't waiting to be accepted", tr.id)
+	}
+	tr.state = DCC_CONNECTING
+	tr.mu.Unlock()
+
+	dir := dccDownloadDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		tr.setState(DCC_FAILED, err)
+		return err
+	}
+	path, err := dccSafePath(dir, tr.filename)
+	if err != nil {
+		tr.setState(DCC_FAILED, err)
+		return err
+	}
+
+	if stat, err := os.Stat(path); err == nil && stat.Size() > 0 && stat.Size() < tr.size {
+		tr.path = path
+		tr.resume(stat.Size())
+		return nil
+	}
+	// never overwrite anything, save as "file (1).ext" instead
+	if err := tr.newPath(dir); err != nil {
+		tr.setState(DCC_FAILED, err)
+		return err
+	}
+	go tr.receive()
+	return nil
+}
+
+func (tr *dccTransfer) newPath(dir string) error {
+	path, err := dccUniquePath(dir, tr.filename)
+	if err != nil {
+		return err
+	}
+	tr.mu.Lock()
+	tr.path = path
+	tr.filename = filepath.Base(path)
+	tr.mu.Unlock()
+	return nil
+}
+
+// resume is the mIRC resume protocol:
+//
+//	-> DCC RESUME <filename> <port> <position>
+//	<- DCC ACCEPT <filename> <port> <position>
+//
+// then we connect as usual and they send the rest. if they never answer
+// we start over from the beginning.
+func (tr *dccTransfer) resume(position int64) {
+	tr.mu.Lock()
+	tr.state = DCC_RESUMING
+	tr.offset = position
+	tr.transferred = position
+	tr.mu.Unlock()
+
+	tr.notify(fmt.Sprintf("already have %s of %s, asking %s to resume", humanSize(position), tr.filename, tr.nick))
+	tr.servConn.conn.Ctcp(tr.nick, "DCC", fmt.Sprintf("RESUME %s %d %d%s", quoteDccFilename(tr.offered), tr.port, position, tr.tokenArg()))
+	tr.servState.refreshTransfers()
+
+	time.AfterFunc(dccResumeTimeout, func() {
+		tr.mu.Lock()
+		if tr.state != DCC_RESUMING {
+			tr.mu.Unlock()
+			return
+		}
+		tr.state = DCC_CONNECTING
+		tr.offset = 0
+		tr.transferred = 0
+		tr.mu.Unlock()
+		// the partial file might not even be the same file, leave it alone
+		if err := tr.newPath(filepath.Dir(tr.path)); err != nil {
+			tr.fail(err)
+			return
+		}
+		tr.notify(tr.nick + " didn't answer the resume request, starting over as " + tr.filename)
+		tr.receive()
+	})
+}
+
+// Resumed is called when the sender agrees to resume at position
+func (tr *dccTransfer) Resumed(position int64) {
+	tr.mu.Lock()
+	if tr.state != DCC_RESUMING {
+		tr.mu.Unlock()
+		return
+	}
+	if position > tr.offset {
+		tr.mu.Unlock()
+		tr.fail(fmt.Errorf("%s wants to resume at %d but we only have %d bytes", tr.nick, position, tr.offset))
+		return
+	}
+	// not necessarily what we asked for but as long as we have that much
+	// it's fine
+	tr.offset = position
+	tr.transferred = position
+	tr.state = DCC_CONNECTING
+	tr.mu.Unlock()
+	go tr.receive()
+}
+
+// Decline refuses an offered file. there's no standard way to tell the
+// sender but some clients understand DCC REJECT.
+func (tr *dccTransfer) Decline() error {
+	return tr.decline(nil)
+}
+
+// decline with a reason is when it was turned down automatically
+func (tr *dccTransfer) decline(reason error) error {
+	tr.mu.Lock()
+	if !tr.incoming || tr.state != DCC_PENDING {
+		tr.mu.Unlock()
+		return fmt.Errorf("transfer #%d isn't waiting to be accepted", tr.id)
+	}
+	tr.mu.Unlock()
+	// anyone can make us send these automatically so they count the same
+	// as any other CTCP reply, if there's too many we just don't say
+	if reason == nil || tr.allowReply() {
+		tr.servConn.conn.CtcpReply(tr.nick, "DCC", "REJECT SEND "+tr.offered)
+	}
+	tr.setState(DCC_DECLINED, reason)
+	return nil
+}
+
+func (tr *dccTransfer) allowReply() bool {
+	allow, _ := tr.servConn.ctcpLimit.Allow(tr.nick, time.Now())
+	return allow
+}
+
+func (tr *dccTransfer) receive() {
+	tr.servState.refreshTransfers()
+
+	var conn net.Conn
+	var err error
+	if tr.passive() {
+		conn, err = tr.listenForSender()
+	} else {
+		addr := net.JoinHostPort(tr.ip.String(), strconv.Itoa(tr.port))
+		conn, err = net.DialTimeout("tcp", addr, dccConnectTimeout)
+	}
+	if err != nil {
+		tr.fail(err)
+		return
+	}
+	defer conn.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if tr.offset > 0 {
+		flags = os.O_WRONLY
+	}
+	f, err := os.OpenFile(tr.path, flags, 0644)
+	if err != nil {
+		tr.fail(err)
+		return
+	}
+	defer f.Close()
+	if tr.offset > 0 {
+		// throw away anything past where we said we'd resume
+		if err := f.Truncate(tr.offset); err != nil {
+			tr.fail(err)
+			return
+		}
+		if _, err := f.Seek(tr.offset, io.SeekStart); err != nil {
+			tr.fail(err)
+			return
+		}
+	}
+
+	tr.mu.Lock()
+	if tr.state != DCC_CONNECTING {
+		// cancelled while we were connecting
+		tr.mu.Unlock()
+		return
+	}
+	tr.conn = conn
+	tr.state = DCC_ACTIVE
+	tr.started = time.Now()
+	tr.mu.Unlock()
+	tr.notify("receiving " + tr.filename + " from " + tr.nick + " into " + tr.path)
+
+	buf := make([]byte, dccBufferSize)
+	ack := make([]byte, 4)
+	// acks are the position in the whole file, not just what we got this time
+	received := tr.offset
+	lastRefresh := time.Now()
+	for tr.size < 0 || received < tr.size {
+		conn.SetReadDeadline(time.Now().Add(dccIdleTimeout))
+		n, err := conn.Read(buf[:tr.readSize()])
+		if n > 0 {
+			if _, err := f.Write(buf[:n]); err != nil {
+				tr.fail(err)
+				return
+			}
+			received += int64(n)
+			tr.mu.Lock()
+			tr.transferred = received
+			tr.mu.Unlock()
+			if max := dccMaxSize(); max > 0 && received > max {
+				// only possible when they didn't tell us the size or lied
+				tr.fail(fmt.Errorf("bigger than the %s limit", humanSize(max)))
+				return
+			}
+
+			// the sender waits for us to acknowledge how much we've got
+			// so far as a 32-bit big-endian number, which wraps around
+			// for files > 4GB
+			binary.BigEndian.PutUint32(ack, uint32(received))
+			if _, err := conn.Write(ack); err != nil {
+				tr.fail(err)
+				return
+			}
+
+			if time.Since(lastRefresh) > time.Millisecond*500 {
+				tr.servState.refreshTransfers()
+				lastRefresh = time.Now()
+			}
+			// not reading makes the sender slow down too
+			tr.throttle(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tr.fail(err)
+			return
+		}
+	}
+
+	if tr.size >= 0 && received != tr.size {
+		tr.fail(fmt.Errorf("expected %s but got %s", humanSize(tr.size), humanSize(received)))
+		return
+	}
+	tr.setState(DCC_DONE, nil)
+	tr.notify(fmt.Sprintf("received %s from %s (%s in %s, %s/s)", tr.filename, tr.nick,
+		humanSize(received-tr.offset), humanDuration(tr.finished.Sub(tr.started)), humanSize(tr.Speed())))
+}
+
+func (tr *dccTransfer) send() {
+	tr.listener.(*net.TCPListener).SetDeadline(time.Now().Add(dccOfferTimeout))
+	conn, err := tr.listener.Accept()
+	tr.listener.Close()
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			err = fmt.Errorf("%s didn't accept within %s", tr.nick, humanDuration(dccOfferTimeout))
+		}
+		tr.fail(err)
+		return
+	}
+	tr.sendTo(conn)
+}
+
+// Connect is the sending end of passive DCC, called when the receiver
+// tells us where to connect
+func (tr *dccTransfer) Connect(ip net.IP, port int) {
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, dccConnectTimeout)
+	if err != nil {
+		tr.fail(err)
+		return
+	}
+	tr.sendTo(conn)
+}
+
+func (tr *dccTransfer) sendTo(conn net.Conn) {
+	defer conn.Close()
+
+	f, err := os.Open(tr.path)
+	if err != nil {
+		tr.fail(err)
+		return
+	}
+	defer f.Close()
+
+	tr.mu.Lock()
+	if tr.state != DCC_PENDING {
+		tr.mu.Unlock()
+		return
+	}
+	tr.conn = conn
+	tr.state = DCC_ACTIVE
+	tr.started = time.Now()
+	tr.mu.Unlock()
+	tr.notify("sending " + tr.filename + " to " + tr.nick)
+
+	if tr.offset > 0 {
+		if _, err := f.Seek(tr.offset, io.SeekStart); err != nil {
+			tr.fail(err)
+			return
+		}
+	}
+
+	// the receiver tells us how much it has so far as a 32-bit number,
+	// we keep track of the real 64-bit value for files > 4GB
+	hungUp := make(chan struct{})
+	go func() {
+		defer close(hungUp)
+		ack := make([]byte, 4)
+		total := tr.offset
+		for {
+			if _, err := io.ReadFull(conn, ack); err != nil {
+				return
+			}
+			n := int64(binary.BigEndian.Uint32(ack))
+			total = total&^0xffffffff | n
+			tr.mu.Lock()
+			if total < tr.transferred {
+				total += 1 << 32
+			}
+			tr.transferred = total
+			tr.mu.Unlock()
+		}
+	}()
+
+	buf := make([]byte, dccBufferSize)
+	sent := tr.offset
+	lastRefresh := time.Now()
+	for sent < tr.size {
+		n, err := f.Read(buf[:tr.readSize()])
+		if n > 0 {
+			conn.SetWriteDeadline(time.Now().Add(dccIdleTimeout))
+			if _, err := conn.Write(buf[:n]); err != nil {
+				tr.fail(err)
+				return
+			}
+			sent += int64(n)
+			tr.throttle(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tr.fail(err)
+			return
+		}
+		if time.Since(lastRefresh) > time.Millisecond*500 {
+			tr.servState.refreshTransfers()
+			lastRefresh = time.Now()
+		}
+	}
+
+	// wait for them to acknowledge everything, some clients just hang up
+	// when they're done which is also fine
+	timeout := time.After(dccIdleTimeout)
+	tick := time.NewTicker(time.Millisecond * 100)
+	defer tick.Stop()
+wait:
+	for {
+		select {
+		case <-hungUp:
+			break wait
+		case <-tick.C:
+			if _, transferred, _ := tr.State(); transferred >= sent {
+				break wait
+			}
+		case <-timeout:
+			tr.fail(fmt.Errorf("%s stopped acknowledging", tr.nick))
+			return
+		}
+	}
+
+	_, transferred, _ := tr.State()
+	if transferred > tr.offset && transferred < sent {
+		tr.fail(fmt.Errorf("%s only got %s of %s", tr.nick, humanSize(transferred), humanSize(sent)))
+		return
+	}
+	tr.mu.Lock()
+	tr.transferred = sent
+	tr.mu.Unlock()
+	tr.setState(DCC_DONE, nil)
+	tr.notify(fmt.Sprintf("sent %s to %s (%s in %s, %s/s)", tr.filename, tr.nick,
+		humanSize(sent-tr.offset), humanDuration(tr.finished.Sub(tr.started)), humanSize(tr.Speed())))
+}
+
+// listenForSender is the receiving end of passive DCC: we open a port and
+// tell them where to connect with DCC SEND <filename> <ip> <port> <size> <token>
+func (tr *dccTransfer) listenForSender() (net.Conn, error) {
+	ln, ip, err := dccListen(tr.servConn)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	tr.mu.Lock()
+	tr.listener = ln
+	tr.mu.Unlock()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	tr.servConn.conn.Ctcp(tr.nick, "DCC", fmt.Sprintf("SEND %s %s %d %d %s",
+		quoteDccFilename(tr.offered), formatDccAddr(ip), port, tr.size, tr.token))
+
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(dccConnectTimeout))
+	conn, err := ln.Accept()
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		err = fmt.Errorf("%s didn't connect", tr.nick)
+	}
+	return conn, err
+}
+
+// Cancel stops a transfer that hasn't finished yet
+func (tr *dccTransfer) Cancel() error {
+	tr.mu.Lock()
+	if tr.state >= DCC_DONE {
+		tr.mu.Unlock()
+		return fmt.Errorf("transfer #%d is already %s", tr.id, dccStateString(tr.state))
+	}
+	conn, ln := tr.conn, tr.listener
+	tr.mu.Unlock()
+	tr.setState(DCC_CANCELLED, nil)
+	if conn != nil {
+		conn.Close()
+	}
+	if ln != nil {
+		ln.Close()
+	}
+	return nil
+}
+
+// ResumeRequested is called when the receiver already has part of the file
+// and wants us to start from position instead
+func (tr *dccTransfer) ResumeRequested(position int64) error {
+	tr.mu.Lock()
+	if tr.state != DCC_PENDING {
+		tr.mu.Unlock()
+		return fmt.Errorf("transfer #%d already started", tr.id)
+	}
+	if position < 0 || position >= tr.size {
+		tr.mu.Unlock()
+		return fmt.Errorf("can't resume %s at %d, it's only %d bytes", tr.filename, position, tr.size)
+	}
+	tr.offset = position
+	tr.transferred = position
+	tr.mu.Unlock()
+
+	tr.servConn.conn.Ctcp(tr.nick, "DCC", fmt.Sprintf("ACCEPT %s %d %d%s", quoteDccFilename(tr.filename), tr.port, position, tr.tokenArg()))
+	tr.notify(fmt.Sprintf("%s is resuming %s at %s", tr.nick, tr.filename, humanSize(position)))
+	return nil
+}
+
+// Rejected is called when the other side tells us they don't want it
+func (tr *dccTransfer) Rejected() {
+	if tr.withdraw() {
+		tr.notify(tr.nick + " declined " + tr.filename)
+	}
+}
+
+// withdraw stops listening for our offer if it's still waiting for an
+// answer, false if it isn't. passive offers don't have a listener.
+func (tr *dccTransfer) withdraw() bool {
+	tr.mu.Lock()
+	if tr.state != DCC_PENDING {
+		tr.mu.Unlock()
+		return false
+	}
+	ln := tr.listener
+	tr.mu.Unlock()
+	tr.setState(DCC_DECLINED, nil)
+	if ln != nil {
+		ln.Close()
+	}
+	return true
+}
+
+// String is a one line summary for /dcc list
+func (tr *dccTransfer) String() string {
+	dir := "<-"
+	if !tr.incoming {
+		dir = "->"
+	}
+	line := fmt.Sprintf("#%d %s %s %s  %s  %s", tr.id, dir, tr.nick, bold(tr.filename), tr.Progress(), tr.Status())
+	if state, _, _ := tr.State(); state == DCC_ACTIVE {
+		line += color("  "+humanSize(tr.Speed())+"/s", LightGrey)
+	}
+	return line
+}
+
+// dccTransferList keeps track of every transfer on every server so they
+// can be referred to by number in /dcc commands. mu is never held while
+// taking a transfer's lock, look at them through List() instead.
+type dccTransferList struct {
+	transfers []*dccTransfer
+	nextID    int
+	mu        *sync.Mutex
+	queueMu   *sync.Mutex // one StartQueued at a time
+}
+
+var dccTransfers = &dccTransferList{
+	transfers: []*dccTransfer{},
+	nextID:    1,
+	mu:        &sync.Mutex{},
+	queueMu:   &sync.Mutex{},
+}
+
+// List is a copy of the transfers
+func (dl *dccTransferList) List() []*dccTransfer {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return append([]*dccTransfer{}, dl.transfers...)
+}
+
+func (dl *dccTransferList) Add(tr *dccTransfer) *dccTransfer {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	tr.id = dl.nextID
+	dl.nextID++
+	if tr.mu == nil {
+		tr.mu = &sync.Mutex{}
+	}
+	if tr.rate == nil {
+		tr.rate = newRateLimiter(dccConfigRate(clientCfg.DccTransferRate))
+	}
+	dl.transfers = append(dl.transfers, tr)
+	return tr
+}
+
+func (dl *dccTransferList) Remove(tr *dccTransfer) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	for i, t := range dl.transfers {
+		if t == tr {
+			dl.transfers = append(dl.transfers[0:i], dl.transfers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (dl *dccTransferList) Get(id int) *dccTransfer {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	for _, tr := range dl.transfers {
+		if tr.id == id {
+			return tr
+		}
+	}
+	return nil
+}
+
+// FindPending returns the outgoing offer to nick for filename that they
+// haven't connected to yet
+func (dl *dccTransferList) FindPending(servState *serverState, nick, filename string) *dccTransfer {
+	for _, tr := range dl.List() {
+		if tr.servState == servState && !tr.incoming && tr.nick == nick && sameDccFilename(tr.filename, filename) {
+			if state, _, _ := tr.State(); state == DCC_PENDING {
+				return tr
+			}
+		}
+	}
+	return nil
+}
+
+// FindOffer finds the transfer with nick in state by port, or by token
+// for passive DCC where the port is 0. that's how SEND replies, RESUME and
+// ACCEPT refer to them.
+func (dl *dccTransferList) FindOffer(servState *serverState, nick string, port int, token string, incoming bool, state int) *dccTransfer {
+	for _, tr := range dl.List() {
+		if tr.servState != servState || tr.incoming != incoming || tr.nick != nick {
+			continue
+		}
+		tr.mu.Lock()
+		found := tr.port == port && tr.token == token && tr.state == state
+		tr.mu.Unlock()
+		if found {
+			return tr
+		}
+	}
+	return nil
+}
+
+// ForServer returns the transfers belonging to one connection
+func (dl *dccTransferList) ForServer(servState *serverState) []*dccTransfer {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	ret := []*dccTransfer{}
+	for _, tr := range dl.transfers {
+		if tr.servState == servState {
+			ret = append(ret, tr)
+		}
+	}
+	return ret
+}
+
+// RemoveFinished forgets about finished transfers for a server
+func (dl *dccTransferList) RemoveFinished(servState *serverState) {
+	done := map[*dccTransfer]bool{}
+	for _, tr := range dl.List() {
+		if tr.servState == servState && tr.Done() {
+			done[tr] = true
+		}
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	keep := []*dccTransfer{}
+	for _, tr := range dl.transfers {
+		if !done[tr] {
+			keep = append(keep, tr)
+		}
+	}
+	dl.transfers = keep
+}
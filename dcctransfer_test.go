@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestDccWithdraw(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	for _, test := range []struct {
+		name     string
+		token    string
+		listener net.Listener
+	}{
+		{"active", "", ln},
+		{"passive", "123", nil},
+	} {
+		tr := &dccTransfer{
+			servState: &serverState{},
+			nick:      "tso",
+			filename:  "file.txt",
+			token:     test.token,
+			state:     DCC_PENDING,
+			listener:  test.listener,
+			mu:        &sync.Mutex{},
+		}
+		if !tr.withdraw() {
+			t.Errorf("%s: expected a pending offer to be withdrawn", test.name)
+		}
+		if state, _, _ := tr.State(); state != DCC_DECLINED {
+			t.Errorf("%s: expected %s got %s", test.name, dccStateString(DCC_DECLINED), dccStateString(state))
+		}
+		if tr.withdraw() {
+			t.Errorf("%s: withdrawn twice", test.name)
+		}
+	}
+
+	if _, err := ln.Accept(); err == nil {
+		t.Error("expected the listener to be closed")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// floodConfig is "flood" in config.json, anyone who trips it gets ignored
+// for a while. zero values mean the defaults below.
+type floodConfig struct {
+	Disabled      bool   `json:"disabled,omitempty"`
+	Lines         int    `json:"lines,omitempty"`         // this many messages...
+	Seconds       int    `json:"seconds,omitempty"`       // ...within this many seconds is a flood
+	Repeats       int    `json:"repeats,omitempty"`       // the same message this many times in a row
+	MassHighlight int    `json:"masshighlight,omitempty"` // nicks mentioned in one message
+	IgnoreFor     string `json:"ignorefor,omitempty"`     // e.g. "10m"
+}
+
+const (
+	floodDefaultLines         = 8
+	floodDefaultSeconds       = 5
+	floodDefaultRepeats       = 4
+	floodDefaultMassHighlight = 6
+	floodDefaultIgnoreFor     = 10 * time.Minute
+
+	// repeats further apart than this don't count
+	floodRepeatWindow = time.Minute
+)
+
+func orDefault(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return n
+}
+
+func (cfg *floodConfig) ignoreFor() time.Duration {
+	if d, err := parseDuration(cfg.IgnoreFor); cfg.IgnoreFor != "" && err == nil && d > 0 {
+		return d
+	}
+	return floodDefaultIgnoreFor
+}
+
+// countNicks is how many different nicks in the channel msg mentions, has
+// is nickList.Has
+func countNicks(msg string, has func(string) bool) int {
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(stripFmtChars(msg)) {
+		word = strings.Trim(word, ":,.!?@")
+		if word != "" && !seen[word] && has(word) {
+			seen[word] = true
+		}
+	}
+	return len(seen)
+}
+
+type floodSender struct {
+	times   []time.Time
+	last    string
+	lastAt  time.Time
+	repeats int
+}
+
+// floodDetector keeps track of what everyone on a server has said recently
+type floodDetector struct {
+	senders map[string]*floodSender
+	mu      *sync.Mutex
+}
+
+func newFloodDetector() *floodDetector {
+	return &floodDetector{
+		senders: map[string]*floodSender{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+// Check records a message from sender (user@host) at t mentioning nicks
+// people and returns why it's spam, or "" if it isn't
+func (fd *floodDetector) Check(cfg *floodConfig, sender, msg string, nicks int, t time.Time) string {
+	if cfg.Disabled {
+		return ""
+	}
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	window := time.Duration(orDefault(cfg.Seconds, floodDefaultSeconds)) * time.Second
+	cutoff := t.Add(-window)
+	if len(fd.senders) > 500 {
+		for key, s := range fd.senders {
+			if len(pruneTimes(s.times, cutoff)) == 0 && t.Sub(s.lastAt) > floodRepeatWindow {
+				delete(fd.senders, key)
+			}
+		}
+	}
+
+	key := strings.ToLower(sender)
+	s, ok := fd.senders[key]
+	if !ok {
+		s = &floodSender{}
+		fd.senders[key] = s
+	}
+	s.times = append(pruneTimes(s.times, cutoff), t)
+
+	text := strings.ToLower(strings.TrimSpace(stripFmtChars(msg)))
+	if text != "" && text == s.last && t.Sub(s.lastAt) <= floodRepeatWindow {
+		s.repeats++
+	} else {
+		s.repeats = 1
+	}
+	s.last, s.lastAt = text, t
+
+	reason := ""
+	switch {
+	case nicks >= orDefault(cfg.MassHighlight, floodDefaultMassHighlight):
+		reason = "mass highlight"
+	case s.repeats >= orDefault(cfg.Repeats, floodDefaultRepeats):
+		reason = "repeated text"
+	case len(s.times) >= orDefault(cfg.Lines, floodDefaultLines):
+		reason = "flood"
+	}
+	if reason != "" {
+		delete(fd.senders, key)
+	}
+	return reason
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFloodDetector(t *testing.T) {
+	cfg := &floodConfig{Lines: 5, Seconds: 5, Repeats: 3, MassHighlight: 4}
+	start := time.Now()
+
+	for _, test := range []struct {
+		name    string
+		msgs    []string
+		every   time.Duration
+		nicks   int
+		reasons []string // for each message
+	}{
+		{"slow", []string{"a", "b", "c", "d", "e", "f"}, 2 * time.Second, 0, []string{"", "", "", "", "", ""}},
+		{"flood", []string{"a", "b", "c", "d", "e"}, 500 * time.Millisecond, 0, []string{"", "", "", "", "flood"}},
+		{"repeat", []string{"buy now", "BUY NOW", "\x02buy now"}, 10 * time.Second, 0, []string{"", "", "repeated text"}},
+		{"repeat too slow", []string{"hi", "hi", "hi"}, 2 * time.Minute, 0, []string{"", "", ""}},
+		{"mass highlight", []string{"hey"}, 0, 4, []string{"mass highlight"}},
+	} {
+		fd := newFloodDetector()
+		for i, msg := range test.msgs {
+			reason := fd.Check(cfg, "u@h", msg, test.nicks, start.Add(time.Duration(i)*test.every))
+			if reason != test.reasons[i] {
+				t.Errorf("%s: message %d: expected %q got %q", test.name, i, test.reasons[i], reason)
+			}
+		}
+	}
+
+	fd := newFloodDetector()
+	if reason := fd.Check(&floodConfig{Disabled: true}, "u@h", "hey", 100, start); reason != "" {
+		t.Errorf("disabled: expected nothing got %q", reason)
+	}
+}
+
+func TestCountNicks(t *testing.T) {
+	nicks := map[string]bool{"alice": true, "bob": true, "carol": true}
+	has := func(n string) bool { return nicks[n] }
+	for _, test := range []struct {
+		msg   string
+		count int
+	}{
+		{"hello", 0},
+		{"alice: hi", 1},
+		{"alice bob, carol! alice @bob", 3},
+		{"\x02alice\x02 \x0304bob", 2},
+	} {
+		if count := countNicks(test.msg, has); count != test.count {
+			t.Errorf("countNicks(%q): expected %d got %d", test.msg, test.count, count)
+		}
+	}
+}
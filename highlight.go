@@ -0,0 +1,167 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// highlightRules are what makes a message a highlight besides our own nick,
+// "highlight" in config.json has one set for everywhere and can have more
+// for each network by name in "networks"
+type highlightRules struct {
+	Words   []string `json:"words,omitempty"`   // whole words, any case
+	Regexes []string `json:"regexes,omitempty"` // also case insensitive
+	Exclude []string `json:"exclude,omitempty"` // nick!user@host masks that never highlight e.g. bots
+	Mute    []string `json:"mute,omitempty"`    // channels that never highlight
+}
+
+type highlightConfig struct {
+	highlightRules
+	Disabled bool                       `json:"disabled,omitempty"`
+	Networks map[string]*highlightRules `json:"networks,omitempty"`
+}
+
+// rules returns the rules for network, creating them if create is true
+func (cfg *highlightConfig) rules(network string, create bool) *highlightRules {
+	if network == "" {
+		return &cfg.highlightRules
+	}
+	for name, rules := range cfg.Networks {
+		if strings.EqualFold(name, network) {
+			return rules
+		}
+	}
+	if !create {
+		return nil
+	}
+	if cfg.Networks == nil {
+		cfg.Networks = map[string]*highlightRules{}
+	}
+	rules := &highlightRules{}
+	cfg.Networks[network] = rules
+	return rules
+}
+
+// highlightWordRegex matches word on its own, "@" and ":" around it are
+// fine since that's how people address each other
+func highlightWordRegex(word string) string {
+	return `(?:^|\W)` + regexp.QuoteMeta(word) + `(?:\W|$)`
+}
+
+type highlightMatcher struct {
+	regexps []*regexp.Regexp
+	exclude []string
+	mute    []string
+}
+
+func newHighlightMatcher(nick string, rules ...*highlightRules) *highlightMatcher {
+	m := &highlightMatcher{}
+	words := []string{}
+	if nick != "" {
+		words = append(words, highlightWordRegex(nick))
+	}
+	for _, r := range rules {
+		if r == nil {
+			continue
+		}
+		for _, w := range r.Words {
+			if w != "" {
+				words = append(words, highlightWordRegex(w))
+			}
+		}
+		for _, expr := range r.Regexes {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				log.Printf("invalid highlight regex %q: %v", expr, err)
+				continue
+			}
+			m.regexps = append(m.regexps, re)
+		}
+		m.exclude = append(m.exclude, r.Exclude...)
+		m.mute = append(m.mute, r.Mute...)
+	}
+	if len(words) > 0 {
+		m.regexps = append(m.regexps, regexp.MustCompile("(?i)"+strings.Join(words, "|")))
+	}
+	return m
+}
+
+// Match is whether msg from src (nick!user@host) in channel (empty for
+// private messages) is a highlight
+func (m *highlightMatcher) Match(channel, src, msg string) bool {
+	for _, c := range m.mute {
+		if channel != "" && strings.EqualFold(c, channel) {
+			return false
+		}
+	}
+	for _, mask := range m.exclude {
+		if matchMask(mask, src) {
+			return false
+		}
+	}
+	for _, re := range m.regexps {
+		if re.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlighter caches a matcher for each network and nick we're using
+// since they only change when the rules do or we change nicks
+type highlighter struct {
+	cache map[string]*highlightMatcher
+	mu    *sync.Mutex
+}
+
+var highlights = &highlighter{
+	cache: map[string]*highlightMatcher{},
+	mu:    &sync.Mutex{},
+}
+
+// matcher is nil if highlights are off
+func (h *highlighter) matcher(network, nick string) *highlightMatcher {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cfg := &clientCfg.Highlight
+	if cfg.Disabled {
+		return nil
+	}
+	key := strings.ToLower(network + " " + nick)
+	m, ok := h.cache[key]
+	if !ok {
+		m = newHighlightMatcher(nick, &cfg.highlightRules, cfg.rules(network, false))
+		h.cache[key] = m
+	}
+	return m
+}
+
+// View is for looking at the rules without them changing underneath you
+func (h *highlighter) View(fn func(cfg *highlightConfig)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fn(&clientCfg.Highlight)
+}
+
+// Update changes the rules while nobody's matching against them. if fn
+// says it changed anything the cache is thrown away and config.json saved.
+func (h *highlighter) Update(fn func(cfg *highlightConfig) bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !fn(&clientCfg.Highlight) {
+		return nil
+	}
+	h.cache = map[string]*highlightMatcher{}
+	return writeClientConfig()
+}
+
+// Match is whether msg from src to channel on network highlights me
+func (h *highlighter) Match(network, channel, src, me, msg string) bool {
+	if strings.EqualFold(strings.SplitN(src, "!", 2)[0], me) {
+		return false
+	}
+	m := h.matcher(network, me)
+	return m != nil && m.Match(channel, src, msg)
+}
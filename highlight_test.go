@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestHighlightMatcher(t *testing.T) {
+	global := &highlightRules{
+		Words:   []string{"chopsuey", "c++"},
+		Regexes: []string{`\bdeploy(ed|ing)?\b`},
+		Exclude: []string{"*bot!*@*"},
+		Mute:    []string{"#noisy"},
+	}
+	network := &highlightRules{Words: []string{"tso"}}
+	m := newHighlightMatcher("me", global, network, nil)
+
+	for _, test := range []struct {
+		channel, src, msg string
+		match             bool
+	}{
+		{"#chan", "a!u@h", "hey me", true},
+		{"#chan", "a!u@h", "ME: hello", true},
+		{"#chan", "a!u@h", "@me hello", true},
+		{"#chan", "a!u@h", "meme", false},
+		{"#chan", "a!u@h", "I like Chopsuey.", true},
+		{"#chan", "a!u@h", "chopsueys", false},
+		{"#chan", "a!u@h", "writing c++ again", true},
+		{"#chan", "a!u@h", "we DEPLOYED it", true},
+		{"#chan", "a!u@h", "redeploy", false},
+		{"#chan", "a!u@h", "ask tso", true},
+		{"#chan", "newsbot!u@h", "me me me", false},
+		{"#NOISY", "a!u@h", "me", false},
+		{"", "a!u@h", "me", true},
+	} {
+		if match := m.Match(test.channel, test.src, test.msg); match != test.match {
+			t.Errorf("Match(%q, %q, %q): expected %v got %v", test.channel, test.src, test.msg, test.match, match)
+		}
+	}
+}
+
+func TestHighlightConfigRules(t *testing.T) {
+	cfg := &highlightConfig{}
+	if cfg.rules("SomeNet", false) != nil {
+		t.Errorf("expected no rules for a network we haven't added")
+	}
+	rules := cfg.rules("SomeNet", true)
+	rules.Words = append(rules.Words, "x")
+	if r := cfg.rules("somenet", false); r == nil || len(r.Words) != 1 {
+		t.Errorf("expected network rules to be found regardless of case, got %+v", r)
+	}
+	if cfg.rules("", false) != &cfg.highlightRules {
+		t.Errorf("expected empty network to be the global rules")
+	}
+}
@@ -1,85 +1,240 @@
-/*
-NOTE(tso): this is an awful hackjob
-  - couldn't pick a good name for a "list of nicks"
-    because nickList is already a thing
-  - but nickList *SHOULD* actually be adapted for use instead of this shit
-    with the application of just a little critical thinking
-    which I'm apparently incapable of atm
-  - function signatures are inconsistent af because see above
-  - ignoreList should actually be per-server or even per-channel
-  - ignoreList should accept patterns *!@*.* whatever the syntax is i forget
-  - the type of ignoreList should be reusable for a "banList", "inviteList", ...
-  - even though we're using pointer values here we have to update name/host
-    manually because we replace the concrete value in the nickList for some
-    unknown reason I have to investigate why probably something to do with
-    prefixes which are fucked anyway
-  - scratch that we're using values because everything is terrible
-  - rushing to implement this in a suboptimal way because
-    I'm sick of people brewing soykaf and being forced to look at it
-    -tso 2018-08-29 04:03:16a
-*/
 package main
 
-import "sync"
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
-var ignoreList = newListerine()
+// ignores are nick!user@host masks, saved in config.json as "ignores".
+// each one can be limited to some kinds of messages, to one network or one
+// channel, and can expire.
 
-type listerine struct {
-	list []nick
-	mu   *sync.Mutex
+const (
+	IGNORE_PRIVMSG = 1 << iota
+	IGNORE_NOTICE
+	IGNORE_CTCP
+	IGNORE_ACTION
+	IGNORE_JOINPART
+	IGNORE_INVITE
+	IGNORE_DCC
+
+	IGNORE_ALL = IGNORE_PRIVMSG | IGNORE_NOTICE | IGNORE_CTCP | IGNORE_ACTION | IGNORE_JOINPART | IGNORE_INVITE | IGNORE_DCC
+)
+
+var ignoreTypes = map[string]int{
+	"privmsg":  IGNORE_PRIVMSG,
+	"notice":   IGNORE_NOTICE,
+	"ctcp":     IGNORE_CTCP,
+	"action":   IGNORE_ACTION,
+	"joinpart": IGNORE_JOINPART,
+	"invite":   IGNORE_INVITE,
+	"dcc":      IGNORE_DCC,
+}
+
+type ignoreEntry struct {
+	Mask    string     `json:"mask"`
+	Types   []string   `json:"types,omitempty"` // empty means everything
+	Network string     `json:"network,omitempty"`
+	Channel string     `json:"channel,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Server  bool       `json:"server,omitempty"` // also SILENCE'd, see serverignore.go
+}
+
+// parseIgnoreTypes turns e.g. "privmsg,notice" into a list we can save,
+// "all" is the same as not giving any
+func parseIgnoreTypes(str string) ([]string, error) {
+	ret := []string{}
+	for _, t := range strings.Split(strings.ToLower(str), ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if t == "all" {
+			return nil, nil
+		}
+		if t == "join" || t == "part" {
+			t = "joinpart"
+		}
+		if _, ok := ignoreTypes[t]; !ok {
+			return nil, fmt.Errorf("unknown ignore type: %s", t)
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+func (ig *ignoreEntry) types() int {
+	if len(ig.Types) == 0 {
+		return IGNORE_ALL
+	}
+	types := 0
+	for _, t := range ig.Types {
+		types |= ignoreTypes[strings.ToLower(t)]
+	}
+	return types
+}
+
+func (ig *ignoreEntry) Expired(t time.Time) bool {
+	return ig.Expires != nil && !t.Before(*ig.Expires)
+}
+
+// Matches is whether a message of type typ from src (nick!user@host) in
+// channel (empty for private messages) on network should be ignored
+func (ig *ignoreEntry) Matches(network, channel, src string, typ int, t time.Time) bool {
+	if ig.Expired(t) || ig.types()&typ == 0 {
+		return false
+	}
+	if ig.Network != "" && !strings.EqualFold(ig.Network, network) {
+		return false
+	}
+	if ig.Channel != "" && !strings.EqualFold(ig.Channel, channel) {
+		return false
+	}
+	return matchMask(ig.Mask, src)
+}
+
+func (ig *ignoreEntry) String() string {
+	line := bold(ig.Mask)
+	if len(ig.Types) > 0 {
+		line += " " + strings.Join(ig.Types, ",")
+	}
+	if ig.Channel != "" {
+		line += " on " + ig.Channel
+	}
+	if ig.Network != "" {
+		line += " on " + ig.Network
+	}
+	if ig.Server {
+		line += " (server side)"
+	}
+	if ig.Expires != nil {
+		line += color(" for another "+humanDuration(time.Until(*ig.Expires)), LightGrey)
+	}
+	return line
 }
 
-func newListerine() *listerine {
-	return &listerine{
-		list: []nick{},
-		mu:   &sync.Mutex{},
+// ignoreMask turns a nick into a mask on their host if we know it, anything
+// with ! or @ in it is already a mask
+func ignoreMask(nick, host string) string {
+	if strings.ContainsAny(nick, "!@") {
+		return nick
 	}
+	if host != "" && !strings.ContainsAny(nick, "*?") {
+		return "*!*@" + host
+	}
+	return nick + "!*@*"
 }
 
-func (l *listerine) Add(n nick) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.list = append(l.list, n)
+type ignores struct {
+	saveTimer *time.Timer
+	mu        *sync.Mutex
 }
 
-func (l *listerine) Remove(nick string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	for i, n := range l.list {
-		if n.name == nick {
-			l.list = append(l.list[0:i], l.list[i+1:]...)
-			return
+// ignoreSaveDelay is how long we wait after a change before writing
+// config.json, so a flood of auto-ignores is one write instead of hundreds
+const ignoreSaveDelay = time.Second * 5
+
+// ignoreList works on clientCfg.Ignores and saves changes a little later,
+// see Flush
+var ignoreList = &ignores{mu: &sync.Mutex{}}
+
+func (ign *ignores) Has(network, channel, src string, typ int) bool {
+	ign.mu.Lock()
+	defer ign.mu.Unlock()
+	t := time.Now()
+	for _, ig := range clientCfg.Ignores {
+		if ig.Matches(network, channel, src, typ, t) {
+			return true
 		}
 	}
+	return false
 }
 
-func (l *listerine) UpdateHost(name, host string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	for i, n := range l.list {
-		if n.name == name {
-			l.list[i].host = host
+// Add replaces any ignore for the same mask in the same place
+func (ign *ignores) Add(ig *ignoreEntry) {
+	ign.mu.Lock()
+	defer ign.mu.Unlock()
+	keep := []*ignoreEntry{}
+	for _, old := range clientCfg.Ignores {
+		if !(strings.EqualFold(old.Mask, ig.Mask) && strings.EqualFold(old.Network, ig.Network) && strings.EqualFold(old.Channel, ig.Channel)) {
+			keep = append(keep, old)
 		}
 	}
+	clientCfg.Ignores = append(keep, ig)
+	ign.save()
 }
 
-func (l *listerine) UpdateNick(oldNick, newNick string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	for i, n := range l.list {
-		if n.name == oldNick {
-			l.list[i].name = newNick
+// Remove removes the ignores that match and returns them
+func (ign *ignores) Remove(match func(ig *ignoreEntry) bool) []*ignoreEntry {
+	ign.mu.Lock()
+	defer ign.mu.Unlock()
+	keep, removed := []*ignoreEntry{}, []*ignoreEntry{}
+	for _, ig := range clientCfg.Ignores {
+		if match(ig) {
+			removed = append(removed, ig)
+		} else {
+			keep = append(keep, ig)
 		}
 	}
+	if len(removed) == 0 {
+		return removed
+	}
+	clientCfg.Ignores = keep
+	ign.save()
+	return removed
 }
 
-func (l *listerine) Has(name, host string) bool {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	for _, n := range l.list {
-		if n.name == name || n.host == host {
-			return true
+// List returns the ignores that haven't expired. expired ones stay in
+// config.json until the next time it's saved.
+func (ign *ignores) List() []*ignoreEntry {
+	ign.mu.Lock()
+	defer ign.mu.Unlock()
+	t := time.Now()
+	keep := []*ignoreEntry{}
+	for _, ig := range clientCfg.Ignores {
+		if !ig.Expired(t) {
+			keep = append(keep, ig)
 		}
 	}
-	return false
+	sort.SliceStable(keep, func(i, j int) bool {
+		return strings.ToLower(keep[i].Mask) < strings.ToLower(keep[j].Mask)
+	})
+	return keep
+}
+
+// save writes config.json in a little while unless it's already going to,
+// ign.mu must be held
+func (ign *ignores) save() {
+	if ign.saveTimer != nil {
+		return
+	}
+	ign.saveTimer = time.AfterFunc(ignoreSaveDelay, func() {
+		if err := ign.Flush(); err != nil {
+			log.Println("couldn't save ignores:", err)
+		}
+	})
+}
+
+// Flush writes any changes now, for when we're exiting
+func (ign *ignores) Flush() error {
+	ign.mu.Lock()
+	defer ign.mu.Unlock()
+	if ign.saveTimer == nil {
+		return nil
+	}
+	ign.saveTimer.Stop()
+	ign.saveTimer = nil
+	t := time.Now()
+	keep := []*ignoreEntry{}
+	for _, ig := range clientCfg.Ignores {
+		if !ig.Expired(t) {
+			keep = append(keep, ig)
+		}
+	}
+	clientCfg.Ignores = keep
+	return writeClientConfig()
 }
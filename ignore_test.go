@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIgnoreMatches(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+	src := "spammer!spam@bad.example.org"
+	for _, test := range []struct {
+		ig      ignoreEntry
+		network string
+		channel string
+		typ     int
+		match   bool
+	}{
+		{ignoreEntry{Mask: "*!*@bad.example.org"}, "net", "#chan", IGNORE_PRIVMSG, true},
+		{ignoreEntry{Mask: "*!*@*.example.org"}, "net", "", IGNORE_DCC, true},
+		{ignoreEntry{Mask: "SPAMMER!*@*"}, "net", "", IGNORE_NOTICE, true},
+		{ignoreEntry{Mask: "other!*@*"}, "net", "", IGNORE_NOTICE, false},
+		{ignoreEntry{Mask: "spammer!*@*", Types: []string{"ctcp", "dcc"}}, "net", "", IGNORE_PRIVMSG, false},
+		{ignoreEntry{Mask: "spammer!*@*", Types: []string{"ctcp", "dcc"}}, "net", "", IGNORE_DCC, true},
+		{ignoreEntry{Mask: "spammer!*@*", Network: "Net"}, "net", "", IGNORE_PRIVMSG, true},
+		{ignoreEntry{Mask: "spammer!*@*", Network: "othernet"}, "net", "", IGNORE_PRIVMSG, false},
+		{ignoreEntry{Mask: "spammer!*@*", Channel: "#chan"}, "net", "#CHAN", IGNORE_JOINPART, true},
+		{ignoreEntry{Mask: "spammer!*@*", Channel: "#chan"}, "net", "#other", IGNORE_PRIVMSG, false},
+		{ignoreEntry{Mask: "spammer!*@*", Channel: "#chan"}, "net", "", IGNORE_PRIVMSG, false},
+		{ignoreEntry{Mask: "spammer!*@*", Expires: &future}, "net", "", IGNORE_PRIVMSG, true},
+		{ignoreEntry{Mask: "spammer!*@*", Expires: &past}, "net", "", IGNORE_PRIVMSG, false},
+	} {
+		if m := test.ig.Matches(test.network, test.channel, src, test.typ, now); m != test.match {
+			t.Errorf("%+v Matches(%q, %q, %d): expected %v got %v", test.ig, test.network, test.channel, test.typ, test.match, m)
+		}
+	}
+}
+
+func TestParseIgnoreTypes(t *testing.T) {
+	for _, test := range []struct {
+		str   string
+		types int
+		err   bool
+	}{
+		{"privmsg,notice", IGNORE_PRIVMSG | IGNORE_NOTICE, false},
+		{"CTCP, dcc", IGNORE_CTCP | IGNORE_DCC, false},
+		{"join", IGNORE_JOINPART, false},
+		{"all", IGNORE_ALL, false},
+		{"privmsg,bogus", 0, true},
+	} {
+		types, err := parseIgnoreTypes(test.str)
+		if (err != nil) != test.err {
+			t.Errorf("parseIgnoreTypes(%q): expected err %v got %v", test.str, test.err, err)
+			continue
+		}
+		if err == nil {
+			ig := &ignoreEntry{Types: types}
+			if ig.types() != test.types {
+				t.Errorf("parseIgnoreTypes(%q): expected %b got %b", test.str, test.types, ig.types())
+			}
+		}
+	}
+}
+
+func TestIgnoreMask(t *testing.T) {
+	for _, test := range []struct {
+		nick, host, mask string
+	}{
+		{"nick", "", "nick!*@*"},
+		{"nick", "host.example.org", "*!*@host.example.org"},
+		{"*!*@host", "", "*!*@host"},
+		{"nick!user@host", "other", "nick!user@host"},
+		{"ni*", "host", "ni*!*@*"},
+	} {
+		if mask := ignoreMask(test.nick, test.host); mask != test.mask {
+			t.Errorf("ignoreMask(%q, %q): expected %q got %q", test.nick, test.host, test.mask, mask)
+		}
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	goirc "github.com/fluffle/goirc/client"
@@ -20,7 +20,30 @@ type serverConnection struct {
 	cancelRetryConnect  chan struct{}
 
 	isupport map[string]string
-	ip       net.IP
+
+	// ip is our public address if the server told us, localIP is the end of
+	// our connection to the server. see dccAddr()
+	ip      net.IP
+	localIP net.IP
+
+	whois  *whoisCollector
+	regain *nickRegainer
+
+	joinKeys  map[string]string
+	joinRetry *joinRetrier
+
+	ctcpLimit *ctcpLimiter
+	ctcpPing  *ctcpPings
+
+	xdcc  *xdccHelper
+	flood *floodDetector
+
+	silenceExpiry *silenceTimers
+
+	// we asked for TIME ourselves, see serverState.chatLogLocation()
+	timeRequested bool
+
+	mu *sync.Mutex
 }
 
 func connect(servConn *serverConnection, servState *serverState) (success bool) {
@@ -83,6 +106,105 @@ func (servConn *serverConnection) Part(channel, reason string, servState *server
 	delete(servState.channels, chanState.channel)
 }
 
+// Join sends JOIN for one or more channels. keys are matched to channels in
+// order so keyed channels go first. we remember the keys so they end up on
+// channelState and /rejoin and reconnecting still work.
+func (servConn *serverConnection) Join(channels ...*autojoinChannel) {
+	names, keys, unkeyed := []string{}, []string{}, []string{}
+	servConn.mu.Lock()
+	for _, ch := range channels {
+		if ch.Key != "" {
+			names = append(names, ch.Channel)
+			keys = append(keys, ch.Key)
+			servConn.joinKeys[strings.ToLower(ch.Channel)] = ch.Key
+		} else {
+			unkeyed = append(unkeyed, ch.Channel)
+		}
+	}
+	servConn.mu.Unlock()
+	names = append(names, unkeyed...)
+
+	// don't make lines too long
+	const perLine = 10
+	for len(names) > 0 {
+		n := perLine
+		if n > len(names) {
+			n = len(names)
+		}
+		line := "JOIN " + strings.Join(names[:n], ",")
+		if len(keys) > 0 {
+			k := n
+			if k > len(keys) {
+				k = len(keys)
+			}
+			line += " " + strings.Join(keys[:k], ",")
+			keys = keys[k:]
+		}
+		names = names[n:]
+		servConn.conn.Raw(line)
+	}
+}
+
+// joinKey returns the key we used to /join channel, if any
+func (servConn *serverConnection) joinKey(channel string) string {
+	servConn.mu.Lock()
+	defer servConn.mu.Unlock()
+	return servConn.joinKeys[strings.ToLower(channel)]
+}
+
+// chanModeParams says whether channel mode m takes a parameter, going by
+// ISUPPORT PREFIX and CHANMODES=A,B,C,D where A (lists) and B (e.g. +k)
+// always have one, C (e.g. +l) only when set and D never.
+func (servConn *serverConnection) chanModeParams(m byte, add bool) bool {
+	prefix := "(ov)@+"
+	if v, ok := servConn.isupport["PREFIX"]; ok {
+		prefix = v
+	}
+	if i := strings.Index(prefix, ")"); i != -1 && strings.IndexByte(prefix[:i], m) != -1 {
+		return true
+	}
+	chanmodes := "beI,k,l,imnpst"
+	if v, ok := servConn.isupport["CHANMODES"]; ok {
+		chanmodes = v
+	}
+	for i, modes := range strings.Split(chanmodes, ",") {
+		if strings.IndexByte(modes, m) == -1 {
+			continue
+		}
+		switch i {
+		case 0, 1:
+			return true
+		case 2:
+			return add
+		}
+		return false
+	}
+	return false
+}
+
+// parseChanModes walks a mode string like "+ov-k nick1 nick2 key" calling fn
+// for each mode with its parameter (or "" if it doesn't have one)
+func (servConn *serverConnection) parseChanModes(modes string, params []string, fn func(add bool, m byte, param string)) {
+	add := true
+	idx := 0
+	for i := 0; i < len(modes); i++ {
+		m := modes[i]
+		switch m {
+		case '+':
+			add = true
+		case '-':
+			add = false
+		default:
+			param := ""
+			if servConn.chanModeParams(m, add) && idx < len(params) {
+				param = params[idx]
+				idx++
+			}
+			fn(add, m, param)
+		}
+	}
+}
+
 func NewServerConnection(servState *serverState, connectedCallback func()) *serverConnection {
 	// goirc config
 	ident := "chopsuey"
@@ -96,8 +218,15 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 			ServerName:         servState.hostname,
 			InsecureSkipVerify: true,
 		}
-		cfg.NewNick = func(n string) string { return n + "^" }
 	}
+	primaryNick := servState.user.nick
+	altNicks := []string{}
+	nickservPASSWORD := ""
+	if connCfg := findConnectionConfig(servState.hostname, servState.port); connCfg != nil {
+		altNicks = connCfg.AltNicks
+		nickservPASSWORD = connCfg.NickServPASSWORD
+	}
+	cfg.NewNick = altNickFunc(servState, primaryNick, altNicks)
 	cfg.Server = serverAddr(servState.hostname, servState.port)
 	conn := goirc.Client(cfg)
 
@@ -106,7 +235,17 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		conn:                conn,
 		retryConnectEnabled: true,
 		isupport:            map[string]string{},
+		whois:               newWhoisCollector(),
+		joinKeys:            map[string]string{},
+		ctcpLimit:           newCtcpLimiter(),
+		ctcpPing:            newCtcpPings(),
+		flood:               newFloodDetector(),
+		silenceExpiry:       newSilenceTimers(),
+		mu:                  &sync.Mutex{},
 	}
+	servConn.joinRetry = newJoinRetrier(servConn)
+	servConn.xdcc = newXdccHelper(servConn, servState)
+	servConn.regain = newNickRegainer(servConn, servState, primaryNick, nickservPASSWORD)
 
 	// goirc events
 	conn.HandleFunc(goirc.CONNECTED, func(c *goirc.Conn, l *goirc.Line) {
@@ -119,21 +258,30 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		servState.connState = DISCONNECTED
 		servState.tab.Update(servState)
 
+		servConn.regain.Reset()
+		servConn.joinRetry.CancelAll()
+		servConn.silenceExpiry.StopAll()
+		// the next server might support different things
+		servConn.isupport = map[string]string{}
+		servConn.mu.Lock()
+		servConn.ip, servConn.localIP = nil, nil
+		servConn.mu.Unlock()
 		if servConn.retryConnectEnabled {
+			// start over with the nick we actually want
+			conn.Config().Me.Nick = primaryNick
 			connectedCallback = func() {
-				for _, cfg := range clientCfg.AutoConnect {
-					if cfg.Host == servState.hostname && cfg.Port == servState.port {
-						if cfg.NickServPASSWORD != "" {
-							servConn.conn.Privmsg("NickServ", "IDENTIFY "+cfg.NickServPASSWORD)
-							<-time.After(time.Second * 7) // ugh
-						}
-						break
+				if cfg := findConnectionConfig(servState.hostname, servState.port); cfg != nil {
+					if cfg.NickServPASSWORD != "" {
+						servConn.conn.Privmsg("NickServ", "IDENTIFY "+cfg.NickServPASSWORD)
+						<-time.After(time.Second * 7) // ugh
 					}
 				}
 
+				channels := []*autojoinChannel{}
 				for _, channel := range servState.channels {
-					conn.Join(channel.channel)
+					channels = append(channels, &autojoinChannel{channel.channel, channel.key})
 				}
+				servConn.Join(channels...)
 			}
 			servConn.Connect(servState)
 		}
@@ -158,7 +306,15 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		// A->A: well then you should just abstract that part, idiot.
 		switch l.Cmd {
 		case "324":
-			msg = "Mode for " + l.Args[1] + " is " + l.Args[2]
+			msg = "Mode for " + l.Args[1] + " is " + strings.Join(l.Args[2:], " ")
+			if chanState, ok := servState.channels[l.Args[1]]; ok {
+				servConn.parseChanModes(l.Args[2], l.Args[3:], func(add bool, m byte, param string) {
+					if m == 'k' && param != "" {
+						chanState.key = param
+					}
+				})
+			}
+			channel = l.Args[1]
 		case "366":
 			return
 		case "333":
@@ -188,6 +344,36 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		Println(SERVER_ERROR, dest, append([]string{l.Cmd}, l.Args[1:]...)...)
 	}
 
+	// NONICKNAMEGIVEN: once we're connected the only empty NICK we send is
+	// goirc's after a 433, see altNickFunc
+	conn.HandleFunc("431", func(c *goirc.Conn, l *goirc.Line) {
+		if servState.connState != CONNECTED {
+			printErrorMessage(c, l)
+		}
+	})
+
+	// NICKCOLLISION UNAVAILRESOURCE
+	// goirc only handles 433 by itself, but during a netsplit we're just as
+	// likely to get one of these and then registration never finishes
+	for _, code := range []string{"436", "437"} {
+		conn.HandleFunc(code, func(c *goirc.Conn, l *goirc.Line) {
+			printErrorMessage(c, l)
+			if len(l.Args) < 2 || isChannel(l.Args[1]) || servState.connState == CONNECTED {
+				return
+			}
+			neu := c.Config().NewNick(l.Args[1])
+			c.Config().Me.Nick = neu
+			c.Nick(neu)
+		})
+	}
+
+	// MONOFFLINE
+	conn.HandleFunc("731", func(c *goirc.Conn, l *goirc.Line) {
+		for _, n := range strings.Split(l.Args[len(l.Args)-1], ",") {
+			servConn.regain.Gone(n)
+		}
+	})
+
 	// WELCOME
 	conn.HandleFunc("001", func(c *goirc.Conn, l *goirc.Line) {
 		nick := l.Args[0]
@@ -197,6 +383,21 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 			servState.user.nick = nick
 			servState.tab.Update(servState)
 		}
+		// "Welcome to the ... Network nick!user@host", not every server
+		// includes it
+		if f := strings.Fields(l.Args[len(l.Args)-1]); len(f) > 0 {
+			if i := strings.LastIndex(f[len(f)-1], "@"); i != -1 {
+				servConn.learnHost(f[len(f)-1][i+1:])
+			}
+		}
+		printServerMessage(c, l)
+	})
+
+	// HOSTHIDDEN <nick> <host> :is now your displayed host
+	conn.HandleFunc("396", func(c *goirc.Conn, l *goirc.Line) {
+		if len(l.Args) > 2 {
+			servConn.learnHost(l.Args[1])
+		}
 		printServerMessage(c, l)
 	})
 
@@ -244,12 +445,10 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		"265", "266",
 		// NONE
 		"300",
-		// AWAY USERHOST ISON UNAWAY NOAWAY
-		"301", "302", "303", "305", "306",
-		// WHOISCERTFP WHOISUSER WHOISSERVER WHOISOPERATOR WHOWASUSER
-		"276", "311", "312", "313", "314",
-		// WHOISIDLE ENDOFWHOIS WHOISCHANNELS
-		"317", "318", "319",
+		// USERHOST ISON UNAWAY NOAWAY
+		"302", "303", "305", "306",
+		// WHOWASUSER
+		"314",
 		// VERSION
 		"351",
 		// MOTDSTART MOTD ENDOFMOTD
@@ -262,34 +461,245 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		conn.HandleFunc(code, printServerMessage)
 	}
 
+	whois := whoisHandler(servConn, servState)
+	for _, code := range []string{
+		// WHOISCERTFP WHOISUSER WHOISSERVER WHOISOPERATOR
+		"276", "311", "312", "313",
+		// WHOISIDLE ENDOFWHOIS WHOISCHANNELS WHOISACCOUNT WHOISSECURE
+		"317", "318", "319", "330", "671",
+		// WHOISREGNICK WHOISSPECIAL WHOISBOT WHOISACTUALLY WHOISHOST WHOISMODES
+		"307", "320", "335", "338", "378", "379",
+	} {
+		conn.HandleFunc(code, whois)
+	}
+
+	// AWAY is part of WHOIS but also what we get for messaging someone who's away
+	conn.HandleFunc("301", func(c *goirc.Conn, l *goirc.Line) {
+		if len(l.Args) > 1 && servConn.whois.Get(l.Args[1], false) != nil {
+			whois(c, l)
+			return
+		}
+		printServerMessage(c, l)
+	})
+
 	// RPL_...
 	for _, code := range []string{
 		// CHANNELMODEIS NOTOPIC TOPICWHOTIME
 		"324", "331", "333",
-		// INVITING INVITELIST EXCEPTLIST BANLIST
-		"341", "346", "348", "367",
+		// INVITING
+		"341",
 		// NOTE(tso): idk if I want to display these end of list messages
 		//            same with end of whois/motd
 		//            I understand why they exist but idk.
 		// -tso 7/12/2018 4:14:48 AM
-		// ENDOFNAMES ENDOFBANLIST ENDOFINVITELIST/ENDOFEXCEPTLIST
-		"366", "368", "349",
+		// ENDOFNAMES
+		"366",
 	} {
 		conn.HandleFunc(code, printChannelMessage)
 	}
 
+	// INVITELIST EXCEPTLIST BANLIST
+	for code, mode := range map[string]byte{"346": 'I', "348": 'e', "367": 'b'} {
+		conn.HandleFunc(code, func(mode byte) goirc.HandlerFunc {
+			return func(c *goirc.Conn, l *goirc.Line) {
+				if len(l.Args) < 3 {
+					printServerMessage(c, l)
+					return
+				}
+				chanState, ok := servState.channels[l.Args[1]]
+				if !ok {
+					printChannelMessage(c, l)
+					return
+				}
+				setter, at := "", time.Time{}
+				if len(l.Args) > 3 {
+					setter = l.Args[3]
+				}
+				if len(l.Args) > 4 {
+					if ts, err := strconv.ParseInt(l.Args[4], 10, 64); err == nil {
+						at = time.Unix(ts, 0)
+					}
+				}
+				chanState.modeList(mode).Receive(l.Args[2], setter, at)
+			}
+		}(mode))
+	}
+
+	// ENDOFINVITELIST ENDOFEXCEPTLIST ENDOFBANLIST
+	for code, mode := range map[string]byte{"347": 'I', "349": 'e', "368": 'b'} {
+		conn.HandleFunc(code, func(mode byte) goirc.HandlerFunc {
+			return func(c *goirc.Conn, l *goirc.Line) {
+				if len(l.Args) < 2 {
+					return
+				}
+				chanState, ok := servState.channels[l.Args[1]]
+				if !ok {
+					return
+				}
+				ml := chanState.modeList(mode)
+				ml.End()
+				printModeList(chanState.tab, chanState, ml, ml.TakePendingSearch())
+			}
+		}(mode))
+	}
+
 	// ERR_...
 	for _, code := range []string{"400", "401", "402", "403", "404", "405", "406", "407",
 		"408", "409", "411", "412", "413", "414", "415", "421", "422", "423",
-		"424", "431", "432", "433", "436", "437", "441", "442", "443", "444",
+		"424", "432", "433", "441", "442", "443", "444",
 		"445", "446", "451", "461", "462", "463", "464", "465", "466", "467",
-		"471", "472", "473", "474", "475", "476", "477", "478", "481", "482",
-		"483", "484", "485", "491", "501", "502", "723"} {
+		"472", "476", "478", "481", "482",
+		"483", "484", "485", "491", "501", "502", "712", "713", "714", "723"} {
+		conn.HandleFunc(code, printErrorMessage)
+	}
+
+	// CHANNELISFULL INVITEONLYCHAN BANNEDFROMCHAN BADCHANNELKEY NEEDREGGEDNICK
+	for _, code := range []string{"471", "473", "474", "475", "477"} {
+		conn.HandleFunc(code, joinErrorHandler(servConn, servState))
+	}
+
+	// KNOCK <channel> <nick!user@host> :has asked for an invite
+	conn.HandleFunc("710", func(c *goirc.Conn, l *goirc.Line) {
+		if len(l.Args) < 3 {
+			return
+		}
+		if chanState, ok := servState.channels[l.Args[1]]; ok {
+			clientMessage(chanState.tab, now(), l.Args[2], "is knocking:", strings.Join(l.Args[3:], " "))
+			return
+		}
+		printServerMessage(c, l)
+	})
+	// KNOCKDLVR
+	conn.HandleFunc("711", printServerMessage)
+
+	// SILELIST ENDOFSILELIST ACCEPTLIST ENDOFACCEPT
+	for _, code := range []string{"271", "272", "281", "282"} {
+		conn.HandleFunc(code, printServerMessage)
+	}
+	// SILELISTFULL ACCEPTFULL ACCEPTEXIST ACCEPTNOT
+	for _, code := range []string{"511", "456", "457", "458"} {
 		conn.HandleFunc(code, printErrorMessage)
 	}
+	// once we've seen ISUPPORT: start getting our nick back (with MONITOR
+	// if there is one), put SILENCEs back and find out what time it is there
+	// if we're rotating logs on server time
+	for _, code := range []string{"376", "422"} {
+		conn.HandleFunc(code, func(c *goirc.Conn, l *goirc.Line) {
+			servConn.regain.Start()
+			servConn.syncServerIgnores(servState.networkName)
+			if clientCfg.ChatLogsEnabled && clientCfg.ChatLogRotate == "server" {
+				servConn.mu.Lock()
+				servConn.timeRequested = true
+				servConn.mu.Unlock()
+				c.Raw("TIME")
+			}
+		})
+	}
+
+	// TIME <server> :<whatever the server thinks that means>
+	conn.HandleFunc("391", func(c *goirc.Conn, l *goirc.Line) {
+		servConn.mu.Lock()
+		requested := servConn.timeRequested
+		servConn.timeRequested = false
+		servConn.mu.Unlock()
+		// someone else's /time shouldn't move where our logs rotate
+		if !requested {
+			printServerMessage(c, l)
+			return
+		}
+		if len(l.Args) == 0 {
+			return
+		}
+		if loc, ok := parseServerTime(l.Args[len(l.Args)-1], time.Now()); ok {
+			servState.serverTime = loc
+		}
+	})
+
+	// TARGUMODEG <nick> :is in +g mode (server-side ignore.)
+	conn.HandleFunc("716", func(c *goirc.Conn, l *goirc.Line) {
+		if len(l.Args) < 2 {
+			return
+		}
+		var tab tabWithTextBuffer = servState.CurrentTab()
+		if pmState, ok := servState.privmsgs[l.Args[1]]; ok {
+			tab = pmState.tab
+		}
+		clientError(tab, l.Args[1], "only gets messages from people they've accepted (+g)")
+	})
+	// TARGNOTIFY <nick> :has been informed that you messaged them.
+	conn.HandleFunc("717", func(c *goirc.Conn, l *goirc.Line) {
+		if len(l.Args) < 2 {
+			return
+		}
+		var tab tabWithTextBuffer = servState.CurrentTab()
+		if pmState, ok := servState.privmsgs[l.Args[1]]; ok {
+			tab = pmState.tab
+		}
+		clientMessage(tab, now(), l.Args[1], "has been told you tried to message them")
+	})
+	// UMODEGMSG <nick> <user@host> :is messaging you, and you have umode +g.
+	conn.HandleFunc("718", func(c *goirc.Conn, l *goirc.Line) {
+		if len(l.Args) < 3 {
+			return
+		}
+		nick, host := l.Args[1], l.Args[2]
+		if ignoreList.Has(servState.networkName, "", nick+"!"+host, IGNORE_PRIVMSG) {
+			return
+		}
+		dest := []tabWithTextBuffer{servState.CurrentTab()}
+		if dest[0].Index() != servState.tab.Index() {
+			dest = append(dest, servState.tab)
+		}
+		Println(CLIENT_MESSAGE, dest, now(), bold(nick), "("+host+") is trying to message you, /accept "+nick+" to let them")
+	})
+
+	checkIgnore := func(l *goirc.Line, typ int) bool {
+		target := ""
+		if l.Cmd == goirc.CTCP || l.Cmd == goirc.CTCPREPLY {
+			target = l.Args[1]
+		} else if len(l.Args) > 0 {
+			target = l.Args[0]
+		}
+		if !isChannel(target) {
+			target = ""
+		}
+		return ignoreList.Has(servState.networkName, target, l.Src, typ)
+	}
 
-	checkIgnore := func(l *goirc.Line) bool {
-		return ignoreList.Has(l.Nick, l.Host)
+	// checkFlood ignores whoever sent l for a while if they're flooding,
+	// mass highlighting or repeating themselves
+	checkFlood := func(l *goirc.Line) bool {
+		if l.Nick == "" || l.Host == l.Src || l.Nick == servState.user.nick || isService(l.Nick) {
+			return false
+		}
+		target, msg := "", l.Args[len(l.Args)-1]
+		if l.Cmd == goirc.CTCP {
+			target, msg = l.Args[1], l.Args[0]+" "+msg
+		} else if len(l.Args) > 0 {
+			target = l.Args[0]
+		}
+		nicks := 0
+		var tab tabWithTextBuffer = servState.CurrentTab()
+		if chanState, ok := servState.channels[target]; ok {
+			nicks = countNicks(msg, func(n string) bool {
+				return n != l.Nick && chanState.nickList.Has(n)
+			})
+			tab = chanState.tab
+		}
+		reason := servConn.flood.Check(&clientCfg.Flood, l.Ident+"@"+l.Host, msg, nicks, time.Now())
+		if reason == "" {
+			return false
+		}
+		d := clientCfg.Flood.ignoreFor()
+		expires := time.Now().Add(d)
+		ig := &ignoreEntry{
+			Mask:    ignoreMask(l.Nick, l.Host),
+			Network: servState.networkName,
+			Expires: &expires,
+		}
+		ignoreList.Add(ig)
+		clientMessage(tab, now(), "auto-ignored "+bold(l.Nick)+" ("+ig.Mask+") for "+humanDuration(d)+" ("+reason+")")
+		return true
 	}
 
 	getMessageParams := func(l *goirc.Line) (t tabWithTextBuffer, nick, msg string) {
@@ -302,69 +712,99 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 				return servState.CurrentTab(), nick, msg
 			} else {
 				pmState := ensurePmState(servConn, servState, nick)
+				pmState.SetUserHost(l.Ident + "@" + l.Host)
 				return pmState.tab, nick, msg
 			}
 		}
 		chanState := ensureChanState(servConn, servState, dest)
-		chanState.nickList.SetHost(l.Nick, l.Host)
-		ignoreList.UpdateHost(l.Nick, l.Host)
+		chanState.nickList.SetUserHost(l.Nick, l.Ident, l.Host)
 		nick = chanState.nickList.Get(nick).String()
 		return chanState.tab, nick, msg
 	}
 
-	highlighter := func(nick, msg string) bool {
-		if servState.user.nick == nick {
-			return false
+	// filterIn runs the incoming word filters for wherever l was sent
+	filterIn := func(l *goirc.Line) filterFn {
+		target := l.Nick
+		if len(l.Args) > 0 && isChannel(l.Args[0]) {
+			target = l.Args[0]
+		}
+		return func(msg string) string {
+			return wordFilters.Apply(FILTER_IN, target, msg)
 		}
+	}
 
-		m, _ := regexp.MatchString(`(?i)\b@*`+regexp.QuoteMeta(servState.user.nick)+`(\b|[^\w])`, msg)
-		return m
+	highlighter := func(l *goirc.Line) highlighterFn {
+		channel := ""
+		if len(l.Args) > 0 && isChannel(l.Args[0]) {
+			channel = l.Args[0]
+		}
+		return func(nick, msg string) bool {
+			return highlights.Match(servState.networkName, channel, l.Src, servState.user.nick, msg)
+		}
 	}
 
+	handleCtcp := ctcpHandler(servConn, servState)
+	handleCtcpReply := ctcpReplyHandler(servConn, servState)
 	conn.HandleFunc(goirc.CTCP, func(c *goirc.Conn, l *goirc.Line) {
-		if checkIgnore(l) {
+		typ := IGNORE_CTCP
+		if l.Args[0] == "DCC" {
+			typ = IGNORE_DCC
+		}
+		if checkIgnore(l, typ) {
 			log.Println("[[[IGNORED]]]")
 			return
 		}
-		// TODO(tso): DCC stuff
-		// debugPrint(l)
-		// if l.Args[0] == "DCC" {
-		// 	dccHandler(servConn, l.Nick, l.Args[2])
-		// }
-		clientMessage(servState.CurrentTab(), append([]string{now() + "C(" + l.Src + "->" + servState.user.nick + "):"}, l.Args...)...)
+		if checkFlood(l) {
+			return
+		}
+		if l.Args[0] == "DCC" && len(l.Args) > 2 {
+			dccHandler(servConn, servState, l.Nick, l.Ident+"@"+l.Host, l.Args[2])
+			return
+		}
+		handleCtcp(c, l)
 	})
 	conn.HandleFunc(goirc.CTCPREPLY, func(c *goirc.Conn, l *goirc.Line) {
-		if checkIgnore(l) {
+		if checkIgnore(l, IGNORE_CTCP) {
 			log.Println("[[[IGNORED]]]")
 			return
 		}
-		clientMessage(servState.CurrentTab(), append([]string{now() + "C(" + l.Src + "->" + servState.user.nick + "):"}, l.Args...)...)
+		handleCtcpReply(c, l)
 	})
 
 	conn.HandleFunc(goirc.PRIVMSG, func(c *goirc.Conn, l *goirc.Line) {
-		if checkIgnore(l) {
+		if checkIgnore(l, IGNORE_PRIVMSG) {
 			log.Println("[[[IGNORED]]]")
 			return
 		}
+		if checkFlood(l) {
+			return
+		}
 		t, nick, msg := getMessageParams(l)
-		privateMessageWithHighlight(t, highlighter, nick, msg)
+		servConn.xdcc.Line(l.Nick, l.Args[len(l.Args)-1])
+		privateMessageWithHighlight(t, highlighter(l), filterIn(l), nick, msg)
 	})
 
 	conn.HandleFunc(goirc.ACTION, func(c *goirc.Conn, l *goirc.Line) {
-		if checkIgnore(l) {
+		if checkIgnore(l, IGNORE_ACTION) {
 			log.Println("[[[IGNORED]]]")
 			return
 		}
+		if checkFlood(l) {
+			return
+		}
 		t, nick, msg := getMessageParams(l)
 		nick = strings.Trim(nick, "~&@%+")
-		actionMessageWithHighlight(t, highlighter, nick, msg)
+		actionMessageWithHighlight(t, highlighter(l), filterIn(l), nick, msg)
 	})
 
 	conn.HandleFunc(goirc.NOTICE, func(c *goirc.Conn, l *goirc.Line) {
-		if checkIgnore(l) {
+		if checkIgnore(l, IGNORE_NOTICE) {
 			log.Println("[[[IGNORED]]]")
 			return
 		}
+		if checkFlood(l) {
+			return
+		}
 		var tab tabWithTextBuffer = servState.tab
 		if isChannel(l.Args[0]) {
 			chanState := ensureChanState(servConn, servState, l.Args[0])
@@ -379,7 +819,8 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 			debugPrint(l)
 		}
 
-		noticeMessageWithHighlight(tab, highlighter, append([]string{l.Nick}, l.Args...)...)
+		servConn.xdcc.Line(l.Nick, l.Args[len(l.Args)-1])
+		noticeMessageWithHighlight(tab, highlighter(l), filterIn(l), append([]string{l.Nick}, l.Args...)...)
 	})
 
 	// NAMREPLY
@@ -397,6 +838,9 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 
 	conn.HandleFunc(goirc.JOIN, func(c *goirc.Conn, l *goirc.Line) {
 		channel := l.Args[0]
+		if l.Nick == servState.user.nick {
+			servConn.joinRetry.Cancel(channel)
+		}
 		chanState, ok := servState.channels[channel]
 		if !ok {
 			// forced join
@@ -407,6 +851,9 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		if !chanState.nickList.Has(l.Nick) {
 			chanState.nickList.Add(l.Nick)
 			chanState.tab.updateNickList(chanState)
+			if checkIgnore(l, IGNORE_JOINPART) {
+				return
+			}
 			hostname := ""
 			if !clientCfg.HideHostnames {
 				hostname = "(" + l.Ident + "@" + l.Host + ") "
@@ -425,6 +872,9 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 		}
 		chanState.nickList.Remove(l.Nick)
 		chanState.tab.updateNickList(chanState)
+		if checkIgnore(l, IGNORE_JOINPART) {
+			return
+		}
 		hostname := ""
 		if !clientCfg.HideHostnames {
 			hostname = "(" + l.Ident + "@" + l.Host + ") "
@@ -437,6 +887,7 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 	})
 
 	conn.HandleFunc(goirc.QUIT, func(c *goirc.Conn, l *goirc.Line) {
+		servConn.regain.Gone(l.Nick)
 		reason := l.Args[0]
 		if strings.HasPrefix(reason, "Quit:") {
 			reason = strings.TrimPrefix(reason, "Quit:")
@@ -455,12 +906,27 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 			if chanState.nickList.Has(l.Nick) {
 				chanState.nickList.Remove(l.Nick)
 				chanState.tab.updateNickList(chanState)
-				dest = append(dest, chanState.tab)
+				if !ignoreList.Has(servState.networkName, chanState.channel, l.Src, IGNORE_JOINPART) {
+					dest = append(dest, chanState.tab)
+				}
 			}
 		}
 		Println(JOINPART_MESSAGE, T(dest...), msg...)
 	})
 
+	conn.HandleFunc(goirc.INVITE, func(c *goirc.Conn, l *goirc.Line) {
+		// INVITE <nick> <channel>
+		if len(l.Args) < 2 || checkIgnore(l, IGNORE_INVITE) {
+			return
+		}
+		dest := []tabWithTextBuffer{servState.CurrentTab()}
+		if dest[0].Index() != servState.tab.Index() {
+			dest = append(dest, servState.tab)
+		}
+		Println(CLIENT_MESSAGE, dest, now(), l.Nick+" invited you to "+l.Args[1])
+		Println(CLIENT_MESSAGE, dest, color("type /join "+l.Args[1]+" to accept", LightGrey))
+	})
+
 	conn.HandleFunc(goirc.KICK, func(c *goirc.Conn, l *goirc.Line) {
 		op := l.Nick
 		channel := l.Args[0]
@@ -494,12 +960,14 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 	})
 
 	conn.HandleFunc(goirc.NICK, func(c *goirc.Conn, l *goirc.Line) {
-		ignoreList.UpdateNick(l.Nick, l.Args[0])
 		oldNick := newNick(l.Nick)
 		newNick := newNick(l.Args[0])
 		if oldNick.name == servState.user.nick {
 			servState.user.nick = newNick.name
 			servState.tab.Update(servState)
+			servConn.regain.Check()
+		} else {
+			servConn.regain.Gone(oldNick.name)
 		}
 		for _, chanState := range servState.channels {
 			if chanState.nickList.Has(oldNick.name) {
@@ -531,34 +999,28 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 			if len(nicks) == 0 {
 				msg := fmt.Sprintf("** %s sets mode %s %s", op, mode, channel)
 				updateMessage(chanState.tab, msg)
-				return
+			} else {
+				nickStr := fmt.Sprintf("%s", nicks)
+				nickStr = nickStr[1 : len(nickStr)-1]
+				msg := fmt.Sprintf("** %s sets mode %s %s", op, mode, nickStr)
+				updateMessage(chanState.tab, msg)
 			}
 
-			nickStr := fmt.Sprintf("%s", nicks)
-			nickStr = nickStr[1 : len(nickStr)-1]
-			msg := fmt.Sprintf("** %s sets mode %s %s", op, mode, nickStr)
-			updateMessage(chanState.tab, msg)
-
-			var add bool
-			var idx int
-			prefixUpdater := func(symbol string) {
-				n := nicks[idx]
-				nick := chanState.nickList.Get(n)
-				if add {
-					nick.prefix += symbol
-				} else {
-					nick.prefix = strings.Replace(nick.prefix, symbol, "", -1)
+			servConn.parseChanModes(mode, nicks, func(add bool, b byte, param string) {
+				prefixUpdater := func(symbol string) {
+					nick := chanState.nickList.Get(param)
+					if nick == nil {
+						return
+					}
+					if add {
+						nick.prefix += symbol
+					} else {
+						nick.prefix = strings.Replace(nick.prefix, symbol, "", -1)
+					}
+					chanState.nickList.Set(param, nick)
+					chanState.tab.updateNickList(chanState)
 				}
-				chanState.nickList.Set(n, nick)
-				chanState.tab.updateNickList(chanState)
-				idx++
-			}
-			for _, b := range mode {
 				switch b {
-				case '+':
-					add = true
-				case '-':
-					add = false
 				case 'q':
 					prefixUpdater("~")
 				case 'a':
@@ -569,12 +1031,23 @@ func NewServerConnection(servState *serverState, connectedCallback func()) *serv
 					prefixUpdater("%")
 				case 'v':
 					prefixUpdater("+")
-				case 'b':
-					idx++
-				default:
-					panic("unhandled mode modifer:" + string(b))
+				case 'b', 'e', 'I':
+					if param != "" {
+						ml := chanState.modeList(b)
+						if add {
+							ml.Add(param, l.Src, time.Now())
+						} else {
+							ml.Remove(param)
+						}
+					}
+				case 'k':
+					if add {
+						chanState.key = param
+					} else {
+						chanState.key = ""
+					}
 				}
-			}
+			})
 		} else if op == "" {
 			nick := channel
 			for _, chanState := range servState.channels {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	goirc "github.com/fluffle/goirc/client"
+)
+
+// ERR_CHANNELISFULL   471 <nick> <channel> :Cannot join channel (+l)
+// ERR_INVITEONLYCHAN  473 <nick> <channel> :Cannot join channel (+i)
+// ERR_BANNEDFROMCHAN  474 <nick> <channel> :Cannot join channel (+b)
+// ERR_BADCHANNELKEY   475 <nick> <channel> :Cannot join channel (+k)
+// ERR_NEEDREGGEDNICK  477 <nick> <channel> :Cannot join channel (+r)
+
+const maxJoinRetries = 10
+
+// joinRetrier tries joining full (+l) channels again every so often if
+// "fullchannelretry" is set in config.json
+type joinRetrier struct {
+	servConn *serverConnection
+	pending  map[string]*joinRetry
+	mu       *sync.Mutex
+}
+
+type joinRetry struct {
+	attempts int
+	timer    *time.Timer
+}
+
+func newJoinRetrier(servConn *serverConnection) *joinRetrier {
+	return &joinRetrier{
+		servConn: servConn,
+		pending:  map[string]*joinRetry{},
+		mu:       &sync.Mutex{},
+	}
+}
+
+// Schedule returns which attempt this is, or 0 if we're not going to retry
+func (jr *joinRetrier) Schedule(channel string, after time.Duration) int {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	key := strings.ToLower(channel)
+	retry, ok := jr.pending[key]
+	if !ok {
+		retry = &joinRetry{}
+		jr.pending[key] = retry
+	}
+	if retry.attempts >= maxJoinRetries {
+		delete(jr.pending, key)
+		return 0
+	}
+	retry.attempts++
+	if retry.timer != nil {
+		retry.timer.Stop()
+	}
+	retry.timer = time.AfterFunc(after, func() {
+		jr.servConn.Join(&autojoinChannel{channel, jr.servConn.joinKey(channel)})
+	})
+	return retry.attempts
+}
+
+// Cancel stops retrying channel, e.g. because we got in
+func (jr *joinRetrier) Cancel(channel string) bool {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	key := strings.ToLower(channel)
+	retry, ok := jr.pending[key]
+	if ok {
+		retry.timer.Stop()
+		delete(jr.pending, key)
+	}
+	return ok
+}
+
+func (jr *joinRetrier) CancelAll() {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	for key, retry := range jr.pending {
+		retry.timer.Stop()
+		delete(jr.pending, key)
+	}
+}
+
+func (servConn *serverConnection) canKnock() bool {
+	_, ok := servConn.isupport["KNOCK"]
+	return ok
+}
+
+func joinErrorHandler(servConn *serverConnection, servState *serverState) goirc.HandlerFunc {
+	return func(c *goirc.Conn, l *goirc.Line) {
+		if len(l.Args) < 2 {
+			return
+		}
+		msg := servConn.joinErrorMessage(l.Cmd, l.Args[1])
+
+		dest := []tabWithTextBuffer{servState.CurrentTab()}
+		if dest[0].Index() != servState.tab.Index() {
+			dest = append(dest, servState.tab)
+		}
+		Println(SERVER_ERROR, dest, l.Cmd, msg)
+	}
+}
+
+// joinErrorMessage explains why we couldn't join channel and what to do about
+// it, scheduling another attempt for full channels
+func (servConn *serverConnection) joinErrorMessage(numeric, channel string) string {
+	var msg, hint string
+	knock := false
+	switch numeric {
+	case "471":
+		msg = channel + " is full (+l)"
+		knock = true
+		if d, err := parseDuration(clientCfg.FullChannelRetry); clientCfg.FullChannelRetry != "" && err == nil && d > 0 {
+			if n := servConn.joinRetry.Schedule(channel, d); n > 0 {
+				hint = fmt.Sprintf("trying again in %s (attempt %d of %d)", humanDuration(d), n, maxJoinRetries)
+				knock = false
+			} else {
+				hint = fmt.Sprintf("giving up after %d %s", maxJoinRetries, pluralize("attempt", maxJoinRetries))
+			}
+		}
+	case "473":
+		msg = channel + " is invite-only (+i)"
+		knock = true
+	case "474":
+		msg = "you are banned from " + channel + " (+b)"
+	case "475":
+		msg = channel + " needs a key (+k)"
+		hint = "use /join " + channel + " <key>"
+		knock = true
+	case "477":
+		msg = channel + " only allows registered nicks"
+		hint = "identify with NickServ and try again"
+	}
+	if knock && servConn.canKnock() {
+		if hint != "" {
+			hint += " or "
+		}
+		hint += "use /knock " + channel + " [message] to ask to be let in"
+	}
+	if hint != "" {
+		msg += ", " + hint
+	}
+	return msg
+}
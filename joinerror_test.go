@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJoinRetrier(t *testing.T) {
+	jr := newJoinRetrier(nil)
+	defer jr.CancelAll()
+
+	for i := 1; i <= maxJoinRetries; i++ {
+		if n := jr.Schedule("#full", time.Hour); n != i {
+			t.Fatalf("expected attempt %d got %d", i, n)
+		}
+	}
+	if n := jr.Schedule("#FULL", time.Hour); n != 0 {
+		t.Errorf("expected to give up after %d attempts, got attempt %d", maxJoinRetries, n)
+	}
+	if jr.Cancel("#full") {
+		t.Errorf("expected nothing pending after giving up")
+	}
+	if n := jr.Schedule("#full", time.Hour); n != 1 {
+		t.Errorf("expected to start over after giving up, got attempt %d", n)
+	}
+
+	jr.Schedule("#other", time.Hour)
+	if !jr.Cancel("#Other") {
+		t.Errorf("expected #other to be pending")
+	}
+	if jr.Cancel("#other") {
+		t.Errorf("expected #other to be cancelled already")
+	}
+	if n := jr.Schedule("#other", time.Hour); n != 1 {
+		t.Errorf("expected to start over after cancelling, got attempt %d", n)
+	}
+}
+
+func TestJoinErrorMessage(t *testing.T) {
+	defer func() { clientCfg = nil }()
+
+	for _, test := range []struct {
+		numeric, retry string
+		isupport       map[string]string
+		expected       string
+	}{
+		{"471", "", map[string]string{}, "#chan is full (+l)"},
+		{"471", "", map[string]string{"KNOCK": ""}, "#chan is full (+l), use /knock #chan [message] to ask to be let in"},
+		{"471", "1h", map[string]string{"KNOCK": ""}, "#chan is full (+l), trying again in 1h (attempt 1 of 10)"},
+		{"473", "", map[string]string{}, "#chan is invite-only (+i)"},
+		{"473", "", map[string]string{"KNOCK": ""}, "#chan is invite-only (+i), use /knock #chan [message] to ask to be let in"},
+		{"474", "", map[string]string{"KNOCK": ""}, "you are banned from #chan (+b)"},
+		{"475", "", map[string]string{}, "#chan needs a key (+k), use /join #chan <key>"},
+		{"475", "", map[string]string{"KNOCK": ""}, "#chan needs a key (+k), use /join #chan <key> or use /knock #chan [message] to ask to be let in"},
+		{"477", "", map[string]string{"KNOCK": ""}, "#chan only allows registered nicks, identify with NickServ and try again"},
+	} {
+		clientCfg = &clientConfig{FullChannelRetry: test.retry}
+		servConn := &serverConnection{isupport: test.isupport}
+		servConn.joinRetry = newJoinRetrier(servConn)
+		actual := servConn.joinErrorMessage(test.numeric, "#chan")
+		servConn.joinRetry.CancelAll()
+		if actual != test.expected {
+			t.Errorf("%s (retry %q): expected\n%q\ngot\n%q", test.numeric, test.retry, test.expected, actual)
+		}
+	}
+
+	// giving up
+	clientCfg = &clientConfig{FullChannelRetry: "1h"}
+	servConn := &serverConnection{isupport: map[string]string{}}
+	servConn.joinRetry = newJoinRetrier(servConn)
+	defer servConn.joinRetry.CancelAll()
+	for i := 0; i < maxJoinRetries; i++ {
+		servConn.joinErrorMessage("471", "#chan")
+	}
+	expected := "#chan is full (+l), giving up after 10 attempts"
+	if actual := servConn.joinErrorMessage("471", "#chan"); actual != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, actual)
+	}
+}
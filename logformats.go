@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// chatLogFormat is a kind of chat log file we can write, ChatLogFormat in
+// config.json is a list of them e.g. "text,irssi"
+type chatLogFormat struct {
+	ext    string
+	header func(t time.Time) string // when we start writing to a file, can be nil
+	line   func(w *chatLogWrite) string
+}
+
+var chatLogFormatters = map[string]*chatLogFormat{
+	// what we've always written
+	"text": {".log", func(t time.Time) string {
+		return t.Format("-----------------------Mon Jan 2 15:04:05 -0700 MST 2006-----------------------")
+	}, textLogLine},
+	// one json object per line, see chatLogEntry
+	"json": {".jsonl", nil, func(w *chatLogWrite) string {
+		data, _ := json.Marshal(w.entry)
+		return string(data)
+	}},
+	// for pisg and friends
+	"irssi": {".irssi.log", func(t time.Time) string {
+		return "--- Log opened " + t.Format("Mon Jan 02 15:04:05 2006")
+	}, irssiLogLine},
+	"weechat": {".weechat.log", nil, weechatLogLine},
+}
+
+// chatLogFormats is which logs to write from ChatLogFormat, "both" is text
+// and json
+func chatLogFormats() []*chatLogFormat {
+	names := strings.Split(strings.ToLower(clientCfg.ChatLogFormat), ",")
+	if clientCfg.ChatLogFormat == "both" {
+		names = []string{"text", "json"}
+	}
+	formats := []*chatLogFormat{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if f, ok := chatLogFormatters[name]; ok {
+			formats = append(formats, f)
+		} else {
+			log.Println("unknown chat log format:", name)
+		}
+	}
+	if len(formats) == 0 {
+		formats = append(formats, chatLogFormatters["text"])
+	}
+	return formats
+}
+
+// joinPartRegex picks apart our own join/part/quit messages (see the JOIN,
+// PART and QUIT handlers) so we can write them the way other clients do
+var joinPartRegex = regexp.MustCompile(`^(?:->|<-) (\S+) (?:\((\S+)\) )?has (joined|left|quit)(?: ([#&!+]\S*))?(?:\s+\((.*)\))?$`)
+
+type joinPart struct {
+	nick, userhost, what, channel, reason string
+}
+
+func parseJoinPart(e *chatLogEntry) *joinPart {
+	m := joinPartRegex.FindStringSubmatch(e.Text)
+	if m == nil {
+		return nil
+	}
+	jp := &joinPart{m[1], m[2], m[3], m[4], m[5]}
+	if jp.userhost == "" {
+		jp.userhost = e.UserHost
+	}
+	if jp.channel == "" && jp.what != "quit" {
+		jp.channel = e.Target
+	}
+	return jp
+}
+
+// textLogLine is the line as it was shown, or close to it for imported
+// lines which don't have one
+func textLogLine(w *chatLogWrite) string {
+	if w.line != "" {
+		return w.line
+	}
+	e := w.entry
+	ts := w.t.Format(clientCfg.TimeFormat) + " "
+	switch e.Type {
+	case "PRIVATE_MESSAGE":
+		return ts + "<" + e.Nick + "> " + e.Raw
+	case "ACTION_MESSAGE":
+		return ts + "*" + e.Nick + " " + e.Raw + "*"
+	case "NOTICE_MESSAGE":
+		return ts + "*** NOTICE: " + e.Nick + " " + e.Target + " " + e.Raw
+	}
+	return ts + e.Raw
+}
+
+func irssiLogLine(w *chatLogWrite) string {
+	e := w.entry
+	ts := w.t.Format("15:04") + " "
+	switch e.Type {
+	case "PRIVATE_MESSAGE":
+		return ts + "<" + e.Nick + "> " + e.Text
+	case "ACTION_MESSAGE":
+		return ts + " * " + e.Nick + " " + e.Text
+	case "NOTICE_MESSAGE":
+		if e.Target != "" && isChannel(e.Target) {
+			return ts + "-" + e.Nick + ":" + e.Target + "- " + e.Text
+		}
+		if e.UserHost != "" {
+			return ts + "-" + e.Nick + "(" + e.UserHost + ")- " + e.Text
+		}
+		return ts + "-" + e.Nick + "- " + e.Text
+	case "JOINPART_MESSAGE":
+		if jp := parseJoinPart(e); jp != nil {
+			line := ts + "-!- " + jp.nick + " [" + jp.userhost + "] has " + jp.what
+			if jp.channel != "" {
+				line += " " + jp.channel
+			}
+			if jp.what != "joined" {
+				line += " [" + jp.reason + "]"
+			}
+			return line
+		}
+	}
+	return ts + "-!- " + strings.TrimPrefix(e.Text, "** ")
+}
+
+func weechatLogLine(w *chatLogWrite) string {
+	e := w.entry
+	ts := w.t.Format("2006-01-02 15:04:05") + "\t"
+	switch e.Type {
+	case "PRIVATE_MESSAGE":
+		return ts + e.Nick + "\t" + e.Text
+	case "ACTION_MESSAGE":
+		return ts + " *\t" + e.Nick + " " + e.Text
+	case "NOTICE_MESSAGE":
+		if e.Target != "" && isChannel(e.Target) {
+			return ts + "--\tNotice(" + e.Nick + ") -> " + e.Target + ": " + e.Text
+		}
+		return ts + "--\tNotice(" + e.Nick + "): " + e.Text
+	case "JOINPART_MESSAGE":
+		if jp := parseJoinPart(e); jp != nil {
+			arrow := "<--"
+			if jp.what == "joined" {
+				arrow = "-->"
+			}
+			line := ts + arrow + "\t" + jp.nick + " (" + jp.userhost + ") has " + jp.what
+			if jp.channel != "" {
+				line += " " + jp.channel
+			}
+			if jp.reason != "" {
+				line += " (" + jp.reason + ")"
+			}
+			return line
+		}
+	case "CLIENT_ERROR", "SERVER_ERROR":
+		return ts + "=!=\t" + e.Text
+	}
+	return ts + "--\t" + strings.TrimPrefix(e.Text, "** ")
+}
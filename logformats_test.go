@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChatLogFormats(t *testing.T) {
+	defer testChatLogs(t, &clientConfig{TimeFormat: "15:04"})()
+	ts := time.Date(2026, 10, 19, 14, 2, 3, 0, time.UTC)
+
+	for _, test := range []struct {
+		entry                chatLogEntry
+		text, irssi, weechat string
+	}{
+		{
+			chatLogEntry{Target: "#chopsuey", Type: "PRIVATE_MESSAGE", Nick: "tso", Raw: "\x02hello", Text: "hello"},
+			"14:02 <tso> \x02hello",
+			"14:02 <tso> hello",
+			"2026-10-19 14:02:03\ttso\thello",
+		},
+		{
+			chatLogEntry{Target: "#chopsuey", Type: "ACTION_MESSAGE", Nick: "tso", Raw: "waves", Text: "waves"},
+			"14:02 *tso waves*",
+			"14:02  * tso waves",
+			"2026-10-19 14:02:03\t *\ttso waves",
+		},
+		{
+			chatLogEntry{Target: "", Type: "NOTICE_MESSAGE", Nick: "NickServ", UserHost: "services@services", Raw: "hi", Text: "hi"},
+			"14:02 *** NOTICE: NickServ  hi",
+			"14:02 -NickServ(services@services)- hi",
+			"2026-10-19 14:02:03\t--\tNotice(NickServ): hi",
+		},
+		{
+			chatLogEntry{Target: "#chopsuey", Type: "JOINPART_MESSAGE", Nick: "tso", UserHost: "~tso@example.com", Raw: "-> tso has joined #chopsuey", Text: "-> tso has joined #chopsuey"},
+			"14:02 -> tso has joined #chopsuey",
+			"14:02 -!- tso [~tso@example.com] has joined #chopsuey",
+			"2026-10-19 14:02:03\t-->\ttso (~tso@example.com) has joined #chopsuey",
+		},
+		{
+			chatLogEntry{Target: "#chopsuey", Type: "JOINPART_MESSAGE", Nick: "tso", Raw: "<- tso (~tso@example.com) has quit (bye)", Text: "<- tso (~tso@example.com) has quit (bye)"},
+			"14:02 <- tso (~tso@example.com) has quit (bye)",
+			"14:02 -!- tso [~tso@example.com] has quit [bye]",
+			"2026-10-19 14:02:03\t<--\ttso (~tso@example.com) has quit (bye)",
+		},
+		{
+			chatLogEntry{Target: "#chopsuey", Type: "UPDATE_MESSAGE", Raw: "** tso is now known as tso2", Text: "** tso is now known as tso2"},
+			"14:02 ** tso is now known as tso2",
+			"14:02 -!- tso is now known as tso2",
+			"2026-10-19 14:02:03\t--\ttso is now known as tso2",
+		},
+	} {
+		e := test.entry
+		w := &chatLogWrite{t: ts, entry: &e}
+		if got := chatLogFormatters["text"].line(w); got != test.text {
+			t.Errorf("text: expected %q got %q", test.text, got)
+		}
+		if got := chatLogFormatters["irssi"].line(w); got != test.irssi {
+			t.Errorf("irssi: expected %q got %q", test.irssi, got)
+		}
+		if got := chatLogFormatters["weechat"].line(w); got != test.weechat {
+			t.Errorf("weechat: expected %q got %q", test.weechat, got)
+		}
+	}
+
+	for _, test := range []struct {
+		format string
+		exts   []string
+	}{
+		{"", []string{".log"}},
+		{"both", []string{".log", ".jsonl"}},
+		{"text, irssi,weechat", []string{".log", ".irssi.log", ".weechat.log"}},
+		{"bogus", []string{".log"}},
+	} {
+		clientCfg.ChatLogFormat = test.format
+		formats := chatLogFormats()
+		if len(formats) != len(test.exts) {
+			t.Errorf("%q: expected %v got %d formats", test.format, test.exts, len(formats))
+			continue
+		}
+		for i, f := range formats {
+			if f.ext != test.exts[i] {
+				t.Errorf("%q: expected %v got %s at %d", test.format, test.exts, f.ext, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importers read other clients' logs into chatlogs/ so they're kept the same
+// way as ours, see /import. all of them write times in local time.
+
+type chatLogImporter struct {
+	ext string // what their log files are called
+	// parse reads one file, name is its path since some keep the date there
+	parse func(name string, r io.Reader) ([]*chatLogWrite, error)
+	// where is the network and channel (or nick) a file is for, going by
+	// where the client puts them
+	where func(path string) (network, target string)
+}
+
+var chatLogImporters = map[string]*chatLogImporter{
+	"irssi":   {".log", parseIrssiLog, irssiLogWhere},
+	"weechat": {".weechatlog", parseWeechatLog, weechatLogWhere},
+	"znc":     {".log", parseZncLog, zncLogWhere},
+	"mirc":    {".log", parseMircLog, mircLogWhere},
+}
+
+func importedLine(t time.Time, typ int, nick, userhost, raw string) *chatLogWrite {
+	return &chatLogWrite{t: t, entry: &chatLogEntry{
+		Time:     t.Format(time.RFC3339Nano),
+		Type:     msgTypeString(typ),
+		Nick:     strings.TrimLeft(nick, "~&@%+ "),
+		UserHost: userhost,
+		Raw:      raw,
+		Text:     stripFmtChars(raw),
+	}}
+}
+
+// joinPartLine is a join, part or quit the way we'd have printed it so it
+// looks the same as ours in every format
+func joinPartLine(t time.Time, what, nick, userhost, channel, reason string) *chatLogWrite {
+	msg := []string{"<-", nick}
+	if what == "joined" {
+		msg[0] = "->"
+	}
+	if userhost != "" {
+		msg = append(msg, "("+userhost+")")
+	}
+	msg = append(msg, "has", what)
+	if channel != "" {
+		msg = append(msg, channel)
+	}
+	if reason != "" {
+		msg = append(msg, "("+reason+")")
+	}
+	return importedLine(t, JOINPART_MESSAGE, nick, userhost, strings.Join(msg, " "))
+}
+
+// atClock is date at a time of day like 15:04 or 15:04:05
+func atClock(date time.Time, clock string) time.Time {
+	parts := strings.Split(clock, ":")
+	h, _ := strconv.Atoi(parts[0])
+	m, _ := strconv.Atoi(parts[1])
+	s := 0
+	if len(parts) > 2 {
+		s, _ = strconv.Atoi(parts[2])
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), h, m, s, 0, time.Local)
+}
+
+func parseLocalTime(layout, str string) (time.Time, error) {
+	return time.ParseInLocation(layout, strings.Join(strings.Fields(str), " "), time.Local)
+}
+
+var (
+	irssiOpenedRegex  = regexp.MustCompile(`^--- Log opened (.*)$`)
+	irssiDayRegex     = regexp.MustCompile(`^--- Day changed (.*)$`)
+	irssiLineRegex    = regexp.MustCompile(`^(\d\d:\d\d(?::\d\d)?) (.*)$`)
+	irssiPrivmsgRegex = regexp.MustCompile(`^<([^>]+)> ?(.*)$`)
+	irssiActionRegex  = regexp.MustCompile(`^ \* (\S+) ?(.*)$`)
+	irssiJoinRegex    = regexp.MustCompile(`^-!- (\S+) \[([^\]]*)\] has (joined|left|quit) ?([#&!+]\S*)?(?: \[(.*)\])?$`)
+	irssiEventRegex   = regexp.MustCompile(`^-!- (.*)$`)
+	irssiNoticeRegex  = regexp.MustCompile(`^-([^\s(:]+?)(?:\(([^)]*)\)|:\S+)?-(?: (.*))?$`)
+)
+
+// parseIrssiLog reads irssi's default log format, lines like
+// "14:02 <@tso> hello" after "--- Log opened Mon Oct 19 14:02:03 2026"
+func parseIrssiLog(name string, r io.Reader) ([]*chatLogWrite, error) {
+	lines := []*chatLogWrite{}
+	date := time.Time{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := irssiOpenedRegex.FindStringSubmatch(line); m != nil {
+			if t, err := parseLocalTime("Mon Jan 2 15:04:05 2006", m[1]); err == nil {
+				date = t
+			}
+			continue
+		}
+		if m := irssiDayRegex.FindStringSubmatch(line); m != nil {
+			if t, err := parseLocalTime("Mon Jan 2 2006", m[1]); err == nil {
+				date = t
+			}
+			continue
+		}
+		m := irssiLineRegex.FindStringSubmatch(line)
+		if m == nil || date.IsZero() {
+			continue
+		}
+		t, rest := atClock(date, m[1]), m[2]
+		if m := irssiPrivmsgRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, PRIVATE_MESSAGE, m[1], "", m[2]))
+		} else if m := irssiActionRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, ACTION_MESSAGE, m[1], "", m[2]))
+		} else if m := irssiJoinRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, joinPartLine(t, m[3], m[1], m[2], m[4], m[5]))
+		} else if m := irssiEventRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, UPDATE_MESSAGE, "", "", "** "+m[1]))
+		} else if m := irssiNoticeRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, NOTICE_MESSAGE, m[1], m[2], m[3]))
+		} else {
+			lines = append(lines, importedLine(t, SERVER_MESSAGE, "", "", rest))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// irssi's autolog_path is ~/irclogs/$tag/$0.log by default
+func irssiLogWhere(path string) (network, target string) {
+	return filepath.Base(filepath.Dir(path)), strings.TrimSuffix(filepath.Base(path), ".log")
+}
+
+var (
+	weechatLineRegex   = regexp.MustCompile(`^(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d)\t([^\t]*)\t(.*)$`)
+	weechatJoinRegex   = regexp.MustCompile(`^(\S+) \(([^)]*)\) has (joined|left|quit) ?([#&!+]\S*)?(?: \((.*)\))?$`)
+	weechatNoticeRegex = regexp.MustCompile(`^Notice\(([^)]+)\)(?: -> \S+)?: (.*)$`)
+)
+
+// parseWeechatLog reads weechat's logger plugin format, lines like
+// "2026-10-19 14:02:03\t@tso\thello"
+func parseWeechatLog(name string, r io.Reader) ([]*chatLogWrite, error) {
+	lines := []*chatLogWrite{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := weechatLineRegex.FindStringSubmatch(strings.TrimRight(scanner.Text(), "\r"))
+		if m == nil {
+			continue
+		}
+		t, err := parseLocalTime("2006-01-02 15:04:05", m[1])
+		if err != nil {
+			continue
+		}
+		prefix, text := strings.TrimSpace(m[2]), m[3]
+		switch prefix {
+		case "-->", "<--":
+			if m := weechatJoinRegex.FindStringSubmatch(text); m != nil {
+				lines = append(lines, joinPartLine(t, m[3], m[1], m[2], m[4], m[5]))
+			} else {
+				lines = append(lines, importedLine(t, UPDATE_MESSAGE, "", "", "** "+text))
+			}
+		case "*":
+			f := strings.SplitN(text, " ", 2)
+			if len(f) < 2 {
+				f = append(f, "")
+			}
+			lines = append(lines, importedLine(t, ACTION_MESSAGE, f[0], "", f[1]))
+		case "--", "":
+			if m := weechatNoticeRegex.FindStringSubmatch(text); m != nil {
+				lines = append(lines, importedLine(t, NOTICE_MESSAGE, m[1], "", m[2]))
+			} else {
+				lines = append(lines, importedLine(t, UPDATE_MESSAGE, "", "", "** "+text))
+			}
+		case "=!=":
+			lines = append(lines, importedLine(t, SERVER_ERROR, "", "", text))
+		default:
+			lines = append(lines, importedLine(t, PRIVATE_MESSAGE, prefix, "", text))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// weechat calls them irc.network.#channel.weechatlog, and the server buffer
+// irc.server.network.weechatlog
+func weechatLogWhere(path string) (network, target string) {
+	name := strings.TrimSuffix(filepath.Base(path), ".weechatlog")
+	name = strings.TrimPrefix(name, "irc.")
+	if strings.HasPrefix(name, "server.") {
+		return strings.TrimPrefix(name, "server."), ""
+	}
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+var (
+	zncLineRegex   = regexp.MustCompile(`^\[(\d\d:\d\d:\d\d)\] (.*)$`)
+	zncJoinRegex   = regexp.MustCompile(`^\*\*\* (Joins|Parts|Quits): (\S+) \(([^)]*)\)(?: \((.*)\))?$`)
+	zncEventRegex  = regexp.MustCompile(`^\*\*\* (.*)$`)
+	zncActionRegex = regexp.MustCompile(`^\* ([^\s*]+) (.*)$`)
+	zncNoticeRegex = regexp.MustCompile(`^-(\S+?)-(?: (.*))?$`)
+	zncDateRegex   = regexp.MustCompile(`(\d{4})-?(\d\d)-?(\d\d)\.log$`)
+)
+
+// parseZncLog reads the log module's format, lines like
+// "[14:02:03] <tso> hello". the date is in the filename.
+func parseZncLog(name string, r io.Reader) ([]*chatLogWrite, error) {
+	lines := []*chatLogWrite{}
+	m := zncDateRegex.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return lines, nil
+	}
+	date, err := time.ParseInLocation("20060102", m[1]+m[2]+m[3], time.Local)
+	if err != nil {
+		return lines, nil
+	}
+	_, target := zncLogWhere(name)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := zncLineRegex.FindStringSubmatch(strings.TrimRight(scanner.Text(), "\r"))
+		if m == nil {
+			continue
+		}
+		t, rest := atClock(date, m[1]), m[2]
+		if m := irssiPrivmsgRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, PRIVATE_MESSAGE, m[1], "", m[2]))
+		} else if m := zncJoinRegex.FindStringSubmatch(rest); m != nil {
+			what, channel := map[string]string{"Joins": "joined", "Parts": "left", "Quits": "quit"}[m[1]], target
+			if what == "quit" {
+				channel = ""
+			}
+			lines = append(lines, joinPartLine(t, what, m[2], m[3], channel, m[4]))
+		} else if m := zncEventRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, UPDATE_MESSAGE, "", "", "** "+m[1]))
+		} else if m := zncActionRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, ACTION_MESSAGE, m[1], "", m[2]))
+		} else if m := zncNoticeRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, NOTICE_MESSAGE, m[1], "", m[2]))
+		} else {
+			lines = append(lines, importedLine(t, SERVER_MESSAGE, "", "", rest))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// znc keeps them in network/#channel/2006-01-02.log, or used to call them
+// user_network_#channel_20060102.log
+func zncLogWhere(path string) (network, target string) {
+	name := filepath.Base(path)
+	if parts := strings.Split(strings.TrimSuffix(name, ".log"), "_"); len(parts) >= 4 {
+		return parts[1], strings.Join(parts[2:len(parts)-1], "_")
+	}
+	dir := filepath.Dir(path)
+	return filepath.Base(filepath.Dir(dir)), filepath.Base(dir)
+}
+
+var (
+	mircSessionRegex = regexp.MustCompile(`^Session Start: (.*)$`)
+	mircLineRegex    = regexp.MustCompile(`^\[(\d\d:\d\d(?::\d\d)?)\] (.*)$`)
+	mircJoinRegex    = regexp.MustCompile(`^\* (\S+) \(([^)]*)\) has (joined|left) (\S+)(?: \((.*)\))?$`)
+	mircQuitRegex    = regexp.MustCompile(`^\* (\S+) \(([^)]*)\) Quit(?: \((.*)\))?$`)
+	mircEventRegex   = regexp.MustCompile(`^\* (\S+ (?:is now known as|sets mode:|changes topic to|was kicked by) .*)$`)
+	// mirc's own messages look like actions, these are the ones that go in
+	// channel logs
+	mircStatusRegex = regexp.MustCompile(`^\* ((?:Now talking in|Topic is|Set by|Retrieving|Attempting to rejoin|Rejoined channel|You were kicked from|Connecting to|Looking up) .*|Disconnected)$`)
+)
+
+// parseMircLog reads mIRC's logs with timestamps on, lines like
+// "[14:02] <tso> hello" after "Session Start: Mon Oct 19 14:02:03 2026".
+// there's no line for midnight so we notice the clock going backwards.
+func parseMircLog(name string, r io.Reader) ([]*chatLogWrite, error) {
+	lines := []*chatLogWrite{}
+	date, last := time.Time{}, time.Time{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := mircSessionRegex.FindStringSubmatch(line); m != nil {
+			if t, err := parseLocalTime("Mon Jan 2 15:04:05 2006", m[1]); err == nil {
+				date, last = t, t
+			}
+			continue
+		}
+		m := mircLineRegex.FindStringSubmatch(line)
+		if m == nil || date.IsZero() {
+			continue
+		}
+		t, rest := atClock(date, m[1]), m[2]
+		if t.Before(last) {
+			date = date.AddDate(0, 0, 1)
+			t = atClock(date, m[1])
+		}
+		last = t
+		if m := irssiPrivmsgRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, PRIVATE_MESSAGE, m[1], "", m[2]))
+		} else if m := mircJoinRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, joinPartLine(t, m[3], m[1], m[2], m[4], m[5]))
+		} else if m := mircQuitRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, joinPartLine(t, "quit", m[1], m[2], "", m[3]))
+		} else if m := mircEventRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, UPDATE_MESSAGE, "", "", "** "+m[1]))
+		} else if m := mircStatusRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, SERVER_MESSAGE, "", "", m[1]))
+		} else if m := zncActionRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, ACTION_MESSAGE, m[1], "", m[2]))
+		} else if m := zncNoticeRegex.FindStringSubmatch(rest); m != nil {
+			lines = append(lines, importedLine(t, NOTICE_MESSAGE, m[1], "", m[2]))
+		} else {
+			lines = append(lines, importedLine(t, SERVER_MESSAGE, "", "", rest))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// mirc calls them #channel.Network.log
+func mircLogWhere(path string) (network, target string) {
+	name := strings.TrimSuffix(filepath.Base(path), ".log")
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return name[i+1:], name[:i]
+	}
+	return "", name
+}
+
+// chatLogImport is one /import. days we already have logs for, from before
+// it started, are left alone so importing the same thing twice doesn't
+// double them up, and so are today and later since the loggers might be
+// writing to them.
+type chatLogImport struct {
+	importer *chatLogImporter
+	today    string
+	dates    map[string]map[string]bool // by dir, see had
+	skipped  map[string]bool            // days we left alone
+}
+
+// had is whether there were already logs for date in dir when we started
+func (imp *chatLogImport) had(dir, date string) bool {
+	if date >= imp.today {
+		return true
+	}
+	dates, ok := imp.dates[dir]
+	if !ok {
+		dates = map[string]bool{}
+		infos, _ := ioutil.ReadDir(dir)
+		for _, info := range infos {
+			if i := strings.Index(info.Name(), "."); i != -1 {
+				dates[info.Name()[:i]] = true
+			}
+		}
+		imp.dates[dir] = dates
+	}
+	return dates[date]
+}
+
+// importChatLogs reads every log in path (a file or folder) with importer
+// and adds them to chatlogs/ in whatever formats we're writing. network and
+// target override where the files say they're from. skipped is how many
+// days were left out because we had them already, see chatLogImport.
+func importChatLogs(importer *chatLogImporter, path, network, target string) (files, lines, skipped int, err error) {
+	paths := []string{}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if info.IsDir() {
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.HasSuffix(p, importer.ext) {
+				paths = append(paths, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	} else {
+		paths = append(paths, path)
+	}
+
+	imp := &chatLogImport{
+		importer: importer,
+		today:    time.Now().Format(chatLogDateFormat),
+		dates:    map[string]map[string]bool{},
+		skipped:  map[string]bool{},
+	}
+	for _, p := range paths {
+		n, err := imp.file(p, network, target)
+		if err != nil {
+			return files, lines, len(imp.skipped), err
+		}
+		if n > 0 {
+			files++
+			lines += n
+		}
+	}
+	return files, lines, len(imp.skipped), nil
+}
+
+func (imp *chatLogImport) file(path, network, target string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	lines, err := imp.importer.parse(path, f)
+	if err != nil {
+		return 0, err
+	}
+	fileNetwork, fileTarget := imp.importer.where(path)
+	if network == "" {
+		network = fileNetwork
+	}
+	if target == "" {
+		target = fileTarget
+	}
+	if network == "" {
+		network = "imported"
+	}
+
+	out := map[string]*chatLogFile{}
+	defer func() {
+		for _, lf := range out {
+			lf.Close()
+		}
+	}()
+	dir := chatLogDir(network, target)
+	formats := chatLogFormats()
+	n := 0
+	for _, w := range lines {
+		date := w.t.Format(chatLogDateFormat)
+		if imp.had(dir, date) {
+			imp.skipped[filepath.Join(dir, date)] = true
+			continue
+		}
+		w.entry.Network, w.entry.Target = network, target
+		for _, format := range formats {
+			name := filepath.Join(dir, date+format.ext)
+			lf, ok := out[name]
+			if !ok {
+				if lf, err = openChatLogFile(name); err != nil {
+					return n, err
+				}
+				out[name] = lf
+				if format.header != nil {
+					lf.w.WriteString(format.header(w.t) + "\n")
+				}
+			}
+			if _, err := lf.w.WriteString(format.line(w) + "\n"); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatLogImporters(t *testing.T) {
+	defer testChatLogs(t, &clientConfig{TimeFormat: "15:04"})()
+
+	for _, test := range []struct {
+		importer, name, log string
+		expected            []string // time type nick raw
+	}{
+		{
+			"irssi", filepath.Join("irclogs", "Rizon", "#chopsuey.log"),
+			"--- Log opened Mon Oct 19 23:58:00 2026\n" +
+				"23:58 -!- tso [~tso@example.com] has joined #chopsuey\n" +
+				"23:59 <@tso> hello\n" +
+				"--- Day changed Tue Oct 20 2026\n" +
+				"00:01  * tso waves\n" +
+				"00:02 -NickServ(services@services)- hi\n" +
+				"00:02 -chop-suey:#chopsuey- hey - you\n" +
+				"00:03 -!- tso [~tso@example.com] has quit [bye]\n",
+			[]string{
+				"2026-10-19 23:58:00 JOINPART_MESSAGE tso -> tso (~tso@example.com) has joined #chopsuey",
+				"2026-10-19 23:59:00 PRIVATE_MESSAGE tso hello",
+				"2026-10-20 00:01:00 ACTION_MESSAGE tso waves",
+				"2026-10-20 00:02:00 NOTICE_MESSAGE NickServ hi",
+				"2026-10-20 00:02:00 NOTICE_MESSAGE chop-suey hey - you",
+				"2026-10-20 00:03:00 JOINPART_MESSAGE tso <- tso (~tso@example.com) has quit (bye)",
+			},
+		},
+		{
+			"weechat", "irc.rizon.#chopsuey.weechatlog",
+			"2026-10-19 14:02:03\t-->\ttso (~tso@example.com) has joined #chopsuey\n" +
+				"2026-10-19 14:02:04\t@tso\thello\n" +
+				"2026-10-19 14:02:05\t *\ttso waves\n" +
+				"2026-10-19 14:02:06\t--\ttso is now known as tso2\n",
+			[]string{
+				"2026-10-19 14:02:03 JOINPART_MESSAGE tso -> tso (~tso@example.com) has joined #chopsuey",
+				"2026-10-19 14:02:04 PRIVATE_MESSAGE tso hello",
+				"2026-10-19 14:02:05 ACTION_MESSAGE tso waves",
+				"2026-10-19 14:02:06 UPDATE_MESSAGE  ** tso is now known as tso2",
+			},
+		},
+		{
+			"znc", filepath.Join("moddata", "log", "rizon", "#chopsuey", "2026-10-19.log"),
+			"[14:02:03] *** Joins: tso (~tso@example.com)\n" +
+				"[14:02:04] <tso> hello\n" +
+				"[14:02:05] * tso waves\n" +
+				"[14:02:06] *** Quits: tso (~tso@example.com) (bye)\n",
+			[]string{
+				"2026-10-19 14:02:03 JOINPART_MESSAGE tso -> tso (~tso@example.com) has joined #chopsuey",
+				"2026-10-19 14:02:04 PRIVATE_MESSAGE tso hello",
+				"2026-10-19 14:02:05 ACTION_MESSAGE tso waves",
+				"2026-10-19 14:02:06 JOINPART_MESSAGE tso <- tso (~tso@example.com) has quit (bye)",
+			},
+		},
+		{
+			"mirc", "#chopsuey.Rizon.log",
+			"Session Start: Mon Oct 19 23:58:00 2026\r\n" +
+				"[23:58] * Now talking in #chopsuey\r\n" +
+				"[23:58] * Topic is 'welcome'\r\n" +
+				"[23:59] * tso (~tso@example.com) has joined #chopsuey\r\n" +
+				"[00:01] <tso> hello\r\n" +
+				"[00:01] * tso waves\r\n" +
+				"[00:02] * tso (~tso@example.com) Quit (bye)\r\n",
+			[]string{
+				"2026-10-19 23:58:00 SERVER_MESSAGE  Now talking in #chopsuey",
+				"2026-10-19 23:58:00 SERVER_MESSAGE  Topic is 'welcome'",
+				"2026-10-19 23:59:00 JOINPART_MESSAGE tso -> tso (~tso@example.com) has joined #chopsuey",
+				"2026-10-20 00:01:00 PRIVATE_MESSAGE tso hello",
+				"2026-10-20 00:01:00 ACTION_MESSAGE tso waves",
+				"2026-10-20 00:02:00 JOINPART_MESSAGE tso <- tso (~tso@example.com) has quit (bye)",
+			},
+		},
+	} {
+		lines, err := chatLogImporters[test.importer].parse(test.name, strings.NewReader(test.log))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != len(test.expected) {
+			t.Errorf("%s: expected %d lines got %d", test.importer, len(test.expected), len(lines))
+			continue
+		}
+		for i, w := range lines {
+			got := strings.Join([]string{w.t.Format("2006-01-02 15:04:05"), w.entry.Type, w.entry.Nick, w.entry.Raw}, " ")
+			if got != test.expected[i] {
+				t.Errorf("%s: expected %q got %q", test.importer, test.expected[i], got)
+			}
+			if w.t.Location() != time.Local {
+				t.Errorf("%s: expected local time", test.importer)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		importer, path, network, target string
+	}{
+		{"irssi", filepath.Join("irclogs", "Rizon", "#chopsuey.log"), "Rizon", "#chopsuey"},
+		{"weechat", "irc.rizon.#chopsuey.weechatlog", "rizon", "#chopsuey"},
+		{"weechat", "irc.server.rizon.weechatlog", "rizon", ""},
+		{"znc", filepath.Join("log", "rizon", "#chopsuey", "2026-10-19.log"), "rizon", "#chopsuey"},
+		{"znc", "tso_rizon_#chopsuey_20261019.log", "rizon", "#chopsuey"},
+		{"mirc", "#chopsuey.Rizon.log", "Rizon", "#chopsuey"},
+	} {
+		network, target := chatLogImporters[test.importer].where(test.path)
+		if network != test.network || target != test.target {
+			t.Errorf("%s %s: expected %s %s got %s %s", test.importer, test.path, test.network, test.target, network, target)
+		}
+	}
+}
+
+func TestImportChatLogs(t *testing.T) {
+	defer testChatLogs(t, &clientConfig{TimeFormat: "15:04"})()
+	src, err := ioutil.TempDir("", "znc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	today := time.Now().Format("20060102")
+	for name, data := range map[string]string{
+		"tso_rizon_#chopsuey_20201018.log":      "[14:02:04] <tso> hello\n",
+		"tso_rizon_#chopsuey_20201019.log":      "[14:02:04] <tso> hello again\n[14:02:05] <tso> bye\n",
+		"tso_rizon_#chopsuey_" + today + ".log": "[00:00:00] <tso> we're logging this ourselves\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// we already have the 19th
+	dir := chatLogDir("rizon", "#chopsuey")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "2020-10-19.log.gz"), nil, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []struct{ files, lines, skipped int }{{1, 1, 2}, {0, 0, 3}} {
+		files, lines, skipped, err := importChatLogs(chatLogImporters["znc"], src, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files != expected.files || lines != expected.lines || skipped != expected.skipped {
+			t.Errorf("import #%d: expected %d files %d lines %d skipped got %d %d %d", i+1,
+				expected.files, expected.lines, expected.skipped, files, lines, skipped)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "2020-10-18.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "hello"); n != 1 {
+		t.Errorf("expected hello once got %d times:\n%s", n, data)
+	}
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// searching chat logs, see /grep. the index is built the first time someone
+// searches and then kept up to date by the loggers (see chatLogger.run) and
+// by checking for new files every search, so only what's new gets read.
+// for each day we index one log, whichever comes first in logIndexFormats.
+
+// logIndexFile is one day's log for a channel
+type logIndexFile struct {
+	path            string
+	network, target string // as they are on disk
+	date            string // 2006-01-02
+	format          string // see chatLogFormatters
+
+	size    int64 // how much we've read, up to the last full line
+	modTime time.Time
+	lines   int
+	words   map[string][]int // lowercase word -> line numbers
+	nicks   map[string][]int // lowercase nick -> line numbers
+}
+
+type logIndex struct {
+	built bool
+	files map[string]*logIndexFile // by dir and date, see logIndexKey
+	mu    *sync.Mutex
+}
+
+var chatLogIndex = &logIndex{files: map[string]*logIndexFile{}, mu: &sync.Mutex{}}
+
+// logIndexFormats is which log we'd rather index for a day, best first.
+// json knows who said what and the text log is what we show, the irssi and
+// weechat ones are the same lines again so they only count when they're
+// all there is e.g. chatlogformat is just "irssi".
+var logIndexFormats = []string{"json", "text", "irssi", "weechat"}
+
+// logIndexKey is which day's log path is, whatever format it's in, and how
+// much we'd rather index it than the others (0 means don't)
+func logIndexKey(path string) (key, format string, rank int) {
+	name := filepath.Base(path)
+	i := strings.Index(name, ".")
+	if i == -1 {
+		return "", "", 0
+	}
+	if _, err := time.Parse(chatLogDateFormat, name[:i]); err != nil {
+		return "", "", 0
+	}
+	ext := strings.TrimSuffix(name[i:], ".gz")
+	for n, f := range logIndexFormats {
+		if chatLogFormatters[f].ext == ext {
+			return filepath.Join(filepath.Dir(path), name[:i]), f, len(logIndexFormats) - n
+		}
+	}
+	return "", "", 0
+}
+
+func logIndexRank(lf *logIndexFile) int {
+	_, _, rank := logIndexKey(lf.path)
+	return rank
+}
+
+// Updated is for when a logger has written to path
+func (idx *logIndex) Updated(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if !idx.built {
+		return
+	}
+	idx.update(path)
+}
+
+// update (re)reads whatever's new in path, idx.mu must be held
+func (idx *logIndex) update(path string) error {
+	key, format, rank := logIndexKey(path)
+	if rank == 0 {
+		return nil
+	}
+	lf := idx.files[key]
+	if lf != nil && lf.path != path && logIndexRank(lf) > rank {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if lf != nil && lf.path == path {
+			delete(idx.files, key)
+		}
+		return err
+	}
+	if lf != nil && lf.path == path && info.Size() == lf.size && info.ModTime().Equal(lf.modTime) {
+		return nil
+	}
+	// start again if it's a different file, it got smaller or we can't
+	// pick up where we left off because it's compressed
+	if lf == nil || lf.path != path || info.Size() < lf.size || strings.HasSuffix(path, ".gz") {
+		rel, err := filepath.Rel(CHATLOG_DIR, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		if len(parts) < 2 {
+			parts = append(parts, "")
+		}
+		lf = &logIndexFile{
+			path:    path,
+			network: parts[0],
+			target:  parts[1],
+			date:    filepath.Base(key),
+			format:  format,
+			words:   map[string][]int{},
+			nicks:   map[string][]int{},
+		}
+		idx.files[key] = lf
+	}
+	lf.modTime = info.ModTime()
+	err = lf.read()
+	if strings.HasSuffix(path, ".gz") {
+		lf.size = info.Size()
+	}
+	return err
+}
+
+// read indexes lf from where we got to last time
+func (lf *logIndexFile) read() error {
+	f, err := os.Open(lf.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := strings.HasSuffix(lf.path, ".gz")
+	var r io.Reader = f
+	if gz {
+		gzr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		r = gzr
+	} else if _, err := f.Seek(lf.size, io.SeekStart); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			// a line without a newline is still being written and we'll
+			// come back for it, unless it's compressed
+			if gz && line != "" {
+				lf.add(line)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		lf.size += int64(len(line))
+		lf.add(line)
+	}
+}
+
+func (lf *logIndexFile) add(line string) {
+	n := lf.lines
+	lf.lines++
+	nick, text, ok := parseLogLine(lf.format, line)
+	if !ok {
+		return
+	}
+	for _, word := range logWords(text) {
+		lf.words[word] = append(lf.words[word], n)
+	}
+	if nick != "" {
+		nick = strings.ToLower(nick)
+		lf.nicks[nick] = append(lf.nicks[nick], n)
+	}
+}
+
+// logWords is the different words in text, lowercased
+func logWords(text string) []string {
+	seen := map[string]bool{}
+	words := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// textLogNickRegex finds who said something in a text log line, after the
+// timestamp: "15:04 <@nick> hi", "3:04 PM *nick waves*". the timestamp is
+// whatever timeformat was at the time so it's anything up to the first < or *
+var textLogNickRegex = regexp.MustCompile(`^[^<*]*? (?:<([^>\s]+)>|\*([^*\s]+) )`)
+
+// parseLogLine is who said line (if anyone) and what it says without
+// formatting. ok is false for lines that aren't anything like the
+// "-----Mon Jan 2..." at the top of text logs.
+func parseLogLine(format, line string) (nick, text string, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	switch format {
+	case "json":
+		e := &chatLogEntry{}
+		if err := json.Unmarshal([]byte(line), e); err != nil {
+			return "", "", false
+		}
+		return e.Nick, e.Text, true
+	case "irssi":
+		m := irssiLineRegex.FindStringSubmatch(line)
+		if m == nil {
+			return "", "", false
+		}
+		rest := m[2]
+		if m := irssiPrivmsgRegex.FindStringSubmatch(rest); m != nil {
+			nick = m[1]
+		} else if m := irssiActionRegex.FindStringSubmatch(rest); m != nil {
+			nick = m[1]
+		}
+	case "weechat":
+		m := weechatLineRegex.FindStringSubmatch(line)
+		if m == nil {
+			return "", "", false
+		}
+		switch prefix := strings.TrimSpace(m[2]); prefix {
+		case "*":
+			nick = strings.SplitN(m[3], " ", 2)[0]
+		case "-->", "<--", "--", "=!=", "":
+		default:
+			nick = prefix
+		}
+	default:
+		if line == "" || strings.HasPrefix(line, "-----------------------") {
+			return "", "", false
+		}
+		line = stripFmtChars(line)
+		if m := textLogNickRegex.FindStringSubmatch(line); m != nil {
+			nick = m[1] + m[2]
+		}
+	}
+	return strings.TrimLeft(nick, "~&@%+"), line, true
+}
+
+// refresh picks up files written since last time (or everything the first
+// time) and forgets ones that are gone
+func (idx *logIndex) refresh() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.built = true
+	seen := map[string]bool{}
+	filepath.Walk(CHATLOG_DIR, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if key, _, rank := logIndexKey(path); rank > 0 {
+			seen[key] = true
+			idx.update(path)
+		}
+		return nil
+	})
+	for key, lf := range idx.files {
+		if _, err := os.Stat(lf.path); !seen[key] || err != nil {
+			delete(idx.files, key)
+		}
+	}
+}
+
+// logQuery is what to look for, empty fields match everything
+type logQuery struct {
+	network, target, nick string
+	from, to              string // 2006-01-02, inclusive
+	words                 []string
+	regex                 *regexp.Regexp
+}
+
+// logMatch is a file and which lines in it matched
+type logMatch struct {
+	file  *logIndexFile
+	lines []int
+}
+
+// search is every line that matches q, oldest first
+func (idx *logIndex) search(q *logQuery) []*logMatch {
+	idx.refresh()
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	sanitize := func(s string) string {
+		return strings.ToLower(invalidCharsInFilenamesRegex.ReplaceAllString(s, "_"))
+	}
+	matches := []*logMatch{}
+	for _, lf := range idx.files {
+		if q.network != "" && strings.ToLower(lf.network) != sanitize(q.network) ||
+			q.target != "" && strings.ToLower(lf.target) != sanitize(q.target) ||
+			q.from != "" && lf.date < q.from ||
+			q.to != "" && lf.date > q.to {
+			continue
+		}
+		lines := []int(nil) // nil is all of them
+		for _, word := range q.words {
+			lines = intersectLines(lines, lf.words[word])
+		}
+		if q.nick != "" {
+			lines = intersectLines(lines, lf.nicks[strings.ToLower(q.nick)])
+		}
+		if lines == nil {
+			lines = make([]int, lf.lines)
+			for i := range lines {
+				lines[i] = i
+			}
+		}
+		if len(lines) > 0 {
+			matches = append(matches, &logMatch{lf, lines})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i].file, matches[j].file
+		if a.date != b.date {
+			return a.date < b.date
+		}
+		return a.path < b.path
+	})
+	return matches
+}
+
+// intersectLines is the line numbers in both a and b (both sorted), or b if
+// a is nil
+func intersectLines(a, b []int) []int {
+	if a == nil {
+		return append([]int{}, b...)
+	}
+	out := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// eachLogLine calls fn with each line in path and its number, until fn
+// returns false. logs can be big so they're never read all at once.
+func eachLogLine(path string, fn func(n int, line string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 0; scanner.Scan(); n++ {
+		if !fn(n, scanner.Text()) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// displayLogLine is line the way it looks in the text logs
+func displayLogLine(format, line string) string {
+	if format != "json" {
+		return line
+	}
+	e := &chatLogEntry{}
+	if err := json.Unmarshal([]byte(line), e); err != nil {
+		return line
+	}
+	t, err := time.Parse(time.RFC3339Nano, e.Time)
+	if err != nil {
+		return line
+	}
+	return textLogLine(&chatLogWrite{t: t, entry: e})
+}
+
+// logResult is a line to show, context lines are the ones around a match
+type logResult struct {
+	file    *logIndexFile
+	line    string
+	context bool
+	gap     bool // lines were skipped since the last one, only with context
+}
+
+// grepChatLogs searches the logs for q and returns the last max matches with
+// context lines either side, and how many matched in all
+func grepChatLogs(q *logQuery, context, max int) (results []*logResult, total int, err error) {
+	type ref struct {
+		file *logIndexFile
+		line int
+	}
+	hits := []ref{}
+	for _, m := range chatLogIndex.search(q) {
+		if q.regex == nil {
+			for _, n := range m.lines {
+				hits = append(hits, ref{m.file, n})
+			}
+			continue
+		}
+		i := 0
+		err = eachLogLine(m.file.path, func(n int, line string) bool {
+			for i < len(m.lines) && m.lines[i] < n {
+				i++
+			}
+			if i == len(m.lines) {
+				return false
+			}
+			if m.lines[i] == n {
+				if _, text, ok := parseLogLine(m.file.format, line); ok && q.regex.MatchString(text) {
+					hits = append(hits, ref{m.file, n})
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	total = len(hits)
+	if max > 0 && len(hits) > max {
+		hits = hits[len(hits)-max:]
+	}
+
+	// read just the lines we're going to show, hits are in order so for
+	// each file it's anything within context of the next one
+	isHit := map[ref]bool{}
+	fileHits := map[*logIndexFile][]int{}
+	files := []*logIndexFile{}
+	for _, h := range hits {
+		isHit[h] = true
+		if fileHits[h.file] == nil {
+			files = append(files, h.file)
+		}
+		fileHits[h.file] = append(fileHits[h.file], h.line)
+	}
+	want := map[*logIndexFile]map[int]string{}
+	for _, file := range files {
+		lines, next := map[int]string{}, 0
+		err = eachLogLine(file.path, func(n int, line string) bool {
+			for next < len(fileHits[file]) && fileHits[file][next]+context < n {
+				next++
+			}
+			if next == len(fileHits[file]) {
+				return false
+			}
+			if fileHits[file][next]-context <= n {
+				lines[n] = line
+			}
+			return true
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		want[file] = lines
+	}
+
+	var lastFile *logIndexFile
+	lastLine := -1
+	for _, h := range hits {
+		from, to := h.line-context, h.line+context
+		if from < 0 {
+			from = 0
+		}
+		if h.file == lastFile && from <= lastLine {
+			from = lastLine + 1
+		}
+		for n := from; n <= to; n++ {
+			line, ok := want[h.file][n]
+			if !ok {
+				continue
+			}
+			if _, _, ok := parseLogLine(h.file.format, line); !ok {
+				continue
+			}
+			results = append(results, &logResult{
+				file:    h.file,
+				line:    displayLogLine(h.file.format, line),
+				context: !isHit[ref{h.file, n}],
+				gap:     context > 0 && h.file == lastFile && n > lastLine+1,
+			})
+			lastFile, lastLine = h.file, n
+		}
+		if to > lastLine {
+			lastFile, lastLine = h.file, to
+		}
+	}
+	return results, total, nil
+}
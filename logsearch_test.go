@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGrepChatLogs(t *testing.T) {
+	defer testChatLogs(t, &clientConfig{TimeFormat: "15:04"})()
+	network := "chopsuey-search-test"
+	dir := chatLogDir(network, "#test")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("2026-10-17.log", "-----------------------Sat Oct 17 12:00:00 +0000 UTC 2026-----------------------\n"+
+		"12:00 <tso> the quick brown fox\n"+
+		"12:01 <bob> jumps over\n"+
+		"12:02 *tso waves*\n")
+	if err := gzipFile(filepath.Join(dir, "2026-10-17.log")); err != nil {
+		t.Fatal(err)
+	}
+	write("2026-10-18.log", "-----------------------Sun Oct 18 12:00:00 +0000 UTC 2026-----------------------\n"+
+		"12:00 <bob> a lazy dog\n"+
+		"12:01 <@tso> Quick, Brown!\n")
+	// the same day twice, only the json one counts
+	write("2026-10-19.log", "12:00 <tso> quick brown\n")
+	write("2026-10-19.irssi.log", "12:00 <tso> quick brown\n")
+	// timeformat with a space in it
+	write("2026-10-16.log", "3:04 PM <+bob> a fox in the afternoon\n")
+	// days we only have irssi or weechat logs for
+	write("2026-10-15.irssi.log", "--- Log opened Thu Oct 15 12:00:00 2026\n"+
+		"12:00 <@carol> an irssi fox\n"+
+		"12:01  * carol waves\n")
+	write("2026-10-14.weechat.log", "2026-10-14 12:00:00\t@dave\ta weechat fox\n"+
+		"2026-10-14 12:00:01\t *\tdave waves\n")
+	json := ""
+	for i, line := range []string{"one", "two quick brown", "three", "four", "five quick brown"} {
+		json += fmt.Sprintf(`{"timestamp":"2026-10-19T12:0%d:00Z","network":"%s","target":"#test","type":"PRIVATE_MESSAGE","nick":"bob","raw":"%s","text":"%s"}`+"\n",
+			i, network, line, line)
+	}
+	write("2026-10-19.jsonl", json)
+
+	grep := func(q *logQuery, context, max int) []string {
+		q.network = network
+		results, total, err := grepChatLogs(q, context, max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := []string{fmt.Sprint(total)}
+		for _, r := range results {
+			line := r.file.date + " " + r.line
+			if r.gap {
+				out = append(out, "--")
+			}
+			if r.context {
+				line = "  " + line
+			}
+			out = append(out, line)
+		}
+		return out
+	}
+
+	for _, test := range []struct {
+		q            logQuery
+		context, max int
+		expected     []string
+	}{
+		{logQuery{words: []string{"quick", "brown"}}, 0, 20, []string{"4",
+			"2026-10-17 12:00 <tso> the quick brown fox",
+			"2026-10-18 12:01 <@tso> Quick, Brown!",
+			"2026-10-19 12:01 <bob> two quick brown",
+			"2026-10-19 12:04 <bob> five quick brown",
+		}},
+		{logQuery{words: []string{"quick"}, nick: "TSO"}, 0, 20, []string{"2",
+			"2026-10-17 12:00 <tso> the quick brown fox",
+			"2026-10-18 12:01 <@tso> Quick, Brown!",
+		}},
+		{logQuery{words: []string{"quick"}, from: "2026-10-18", to: "2026-10-18"}, 0, 20, []string{"1",
+			"2026-10-18 12:01 <@tso> Quick, Brown!",
+		}},
+		{logQuery{words: []string{"fox"}}, 0, 20, []string{"4",
+			"2026-10-14 2026-10-14 12:00:00\t@dave\ta weechat fox",
+			"2026-10-15 12:00 <@carol> an irssi fox",
+			"2026-10-16 3:04 PM <+bob> a fox in the afternoon",
+			"2026-10-17 12:00 <tso> the quick brown fox",
+		}},
+		{logQuery{nick: "bob", to: "2026-10-17"}, 0, 20, []string{"2",
+			"2026-10-16 3:04 PM <+bob> a fox in the afternoon",
+			"2026-10-17 12:01 <bob> jumps over",
+		}},
+		{logQuery{nick: "carol"}, 0, 20, []string{"2",
+			"2026-10-15 12:00 <@carol> an irssi fox",
+			"2026-10-15 12:01  * carol waves",
+		}},
+		{logQuery{words: []string{"waves"}, nick: "dave"}, 0, 20, []string{"1",
+			"2026-10-14 2026-10-14 12:00:01\t *\tdave waves",
+		}},
+		{logQuery{regex: regexp.MustCompile(`^t`)}, 0, 20, []string{"2",
+			"2026-10-19 12:01 <bob> two quick brown",
+			"2026-10-19 12:02 <bob> three",
+		}},
+		{logQuery{words: []string{"quick"}, target: "#test"}, 1, 2, []string{"4",
+			"  2026-10-19 12:00 <bob> one",
+			"2026-10-19 12:01 <bob> two quick brown",
+			"  2026-10-19 12:02 <bob> three",
+			"  2026-10-19 12:03 <bob> four",
+			"2026-10-19 12:04 <bob> five quick brown",
+		}},
+		{logQuery{words: []string{"five"}, nick: "bob"}, 1, 20, []string{"1",
+			"  2026-10-19 12:03 <bob> four",
+			"2026-10-19 12:04 <bob> five quick brown",
+		}},
+		{logQuery{regex: regexp.MustCompile(`^(one|five)`)}, 0, 20, []string{"2",
+			"2026-10-19 12:00 <bob> one",
+			"2026-10-19 12:04 <bob> five quick brown",
+		}},
+		{logQuery{regex: regexp.MustCompile(`^(one|five)`)}, 1, 20, []string{"2",
+			"2026-10-19 12:00 <bob> one",
+			"  2026-10-19 12:01 <bob> two quick brown",
+			"--",
+			"  2026-10-19 12:03 <bob> four",
+			"2026-10-19 12:04 <bob> five quick brown",
+		}},
+		{logQuery{words: []string{"fox"}, target: "#elsewhere"}, 0, 20, []string{"0"}},
+	} {
+		q := test.q
+		got := grep(&q, test.context, test.max)
+		if strings.Join(got, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%+v: expected\n%s\ngot\n%s", test.q, strings.Join(test.expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+
+	// only the new line gets read
+	lf, err := openChatLogFile(filepath.Join(dir, "2026-10-19.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.w.WriteString(`{"timestamp":"2026-10-19T12:06:00Z","type":"PRIVATE_MESSAGE","nick":"tso","raw":"six","text":"six"}` + "\n")
+	lf.w.WriteString(`{"timestamp":"2026-10-19T12:07:00Z"`) // not finished yet
+	lf.Close()
+	chatLogIndex.Updated(lf.name)
+	if got := grep(&logQuery{words: []string{"six"}}, 0, 20); len(got) != 2 || got[1] != "2026-10-19 12:06 <tso> six" {
+		t.Errorf("expected to find the new line, got %q", got)
+	}
+	chatLogIndex.mu.Lock()
+	defer chatLogIndex.mu.Unlock()
+	if n := chatLogIndex.files[strings.TrimSuffix(lf.name, ".jsonl")].lines; n != 6 {
+		t.Errorf("expected 6 lines indexed got %d", n)
+	}
+}
@@ -22,7 +22,6 @@ import (
 )
 
 const (
-	CHATLOG_DIR     = "./chatlogs/"
 	SCREENSHOTS_DIR = "./screenshots/"
 	SCRIPTS_DIR     = "./scripts/"
 	THEMES_DIR      = "./themes/"
@@ -34,6 +33,9 @@ const (
 	TRANSPARENCY_DEFAULT_ALPHA = 0xb4 // a nice default value: ~70% opaque
 )
 
+// CHATLOG_DIR is a var so tests can write somewhere else
+var CHATLOG_DIR = "./chatlogs/"
+
 var (
 	mw        *myMainWindow
 	tabWidget *walk.TabWidget
@@ -50,6 +52,10 @@ var (
 func exit() {
 	// TODO(tso): send QUIT to all active server connections
 	close(tabMan.destroy)
+	closeChatLogs()
+	if err := ignoreList.Flush(); err != nil {
+		log.Println("couldn't save ignores:", err)
+	}
 	checkErr(mw.Close())
 	systray.Dispose()
 	os.Exit(1)
@@ -228,6 +234,11 @@ func main() {
 					t.textBuffer.SendMessage(win.WM_VSCROLL, win.SB_BOTTOM, 0)
 					t.textBuffer.SendMessage(win.WM_VSCROLL, win.SB_BOTTOM, 0)
 				})
+			case *tabDccChat:
+				t := t.(*tabDccChat)
+				mw.Synchronize(func() {
+					t.textBuffer.SendMessage(win.WM_VSCROLL, win.SB_BOTTOM, 0)
+				})
 			}
 		}
 	})
@@ -292,6 +303,8 @@ func main() {
 			}()
 		}
 	} else {
+		dccBandwidth.SetRate(dccConfigRate(clientCfg.DccRate))
+		go tidyChatLogs(true)
 		if clientCfg.Theme != "" {
 			if err := applyTheme(clientCfg.Theme); err != nil {
 				walk.MsgBox(mw, err.Error(), err.Error(), walk.MsgBoxIconError)
@@ -321,15 +334,13 @@ func main() {
 					}
 					var servConn *serverConnection
 					servConn = NewServerConnection(servState,
-						func(nickservPASSWORD string, autojoin []string) func() {
+						func(nickservPASSWORD string, autojoin []*autojoinChannel) func() {
 							return func() {
 								if nickservPASSWORD != "" {
 									servConn.conn.Privmsg("NickServ", "IDENTIFY "+nickservPASSWORD)
 									<-time.After(time.Second * 7) // ugh
 								}
-								for _, channel := range autojoin {
-									servConn.conn.Join(channel)
-								}
+								servConn.Join(autojoin...)
 							}
 						}(cfg.NickServPASSWORD, cfg.AutoJoin),
 					)
@@ -353,6 +364,7 @@ func main() {
 	}
 
 	mw.Run()
+	closeChatLogs()
 }
 
 // goirc logging...
@@ -76,63 +76,73 @@ func privateMessage(tab tabWithTextBuffer, msg ...string) {
 
 type highlighterFn func(nick, msg string) bool
 
-func noticeMessageWithHighlight(tab tabWithTextBuffer, hl highlighterFn, msg ...string) {
-	PrintlnWithHighlight(NOTICE_MESSAGE, hl, T(tab), msg...)
+// filterFn changes what a message looks like on screen, the logs get what
+// was actually said
+type filterFn func(msg string) string
+
+func noticeMessageWithHighlight(tab tabWithTextBuffer, hl highlighterFn, filter filterFn, msg ...string) {
+	PrintlnWithHighlight(NOTICE_MESSAGE, hl, filter, T(tab), msg...)
 }
-func actionMessageWithHighlight(tab tabWithTextBuffer, hl highlighterFn, msg ...string) {
-	PrintlnWithHighlight(ACTION_MESSAGE, hl, T(tab), msg...)
+func actionMessageWithHighlight(tab tabWithTextBuffer, hl highlighterFn, filter filterFn, msg ...string) {
+	PrintlnWithHighlight(ACTION_MESSAGE, hl, filter, T(tab), msg...)
 }
-func privateMessageWithHighlight(tab tabWithTextBuffer, hl highlighterFn, msg ...string) {
-	PrintlnWithHighlight(PRIVATE_MESSAGE, hl, T(tab), msg...)
+func privateMessageWithHighlight(tab tabWithTextBuffer, hl highlighterFn, filter filterFn, msg ...string) {
+	PrintlnWithHighlight(PRIVATE_MESSAGE, hl, filter, T(tab), msg...)
 }
 
 func T(tabs ...tabWithTextBuffer) []tabWithTextBuffer { return tabs } // expected type, found ILLEGAL
 
-func PrintlnWithHighlight(msgType int, hl highlighterFn, tabs []tabWithTextBuffer, msg ...string) {
+func PrintlnWithHighlight(msgType int, hl highlighterFn, filter filterFn, tabs []tabWithTextBuffer, msg ...string) {
 	switch msgType {
 	case NOTICE_MESSAGE:
+		shown := append([]string{}, msg...)
+		shown[len(shown)-1] = filter(shown[len(shown)-1])
 		for _, tab := range tabs {
-			logmsg := now() + " *** NOTICE: " + strings.Join(msg, " ")
-			tab.Logln(logmsg)
+			logline := noticeLogLine(msg)
+			tab.Logln(logline)
 
 			tab.Notify(true) // always put a * for NOTICE
 
 			h := false
-			if len(msg) >= 3 {
-				h = hl(msg[1], strings.Join(msg[2:], " "))
+			if len(shown) >= 3 {
+				h = hl(shown[1], strings.Join(shown[2:], " "))
 			}
 			if h && !mainWindowFocused {
-				systray.ShowMessage("", logmsg)
+				systray.ShowMessage("", noticeLogLine(shown).Line)
 			}
-			tab.Println(parseString(noticeMsg(h, msg...)))
+			tab.Println(parseString(noticeMsg(h, shown...)))
 		}
 
 	case PRIVATE_MESSAGE:
 		nick, msg := msg[0], strings.Join(msg[1:], " ")
 		logmsg := now() + " <" + nick + "> " + msg
+		logline := &chatLogLine{PRIVATE_MESSAGE, strings.TrimLeft(nick, "~&@%+"), msg, logmsg}
+		msg = filter(msg)
 		h := hl(nick, msg)
 		if h && !mainWindowFocused {
-			systray.ShowMessage("", logmsg)
+			systray.ShowMessage("", now()+" <"+nick+"> "+msg)
 		}
 		for _, tab := range tabs {
 			nick := colorNick(tab, h, nick)
 			nick = leftpadNick(tab, nick)
 			tab.Notify(h)
-			tab.Logln(logmsg)
+			tab.Logln(logline)
 			tab.Println(parseString(privateMsg(h, nick, msg)))
 		}
 
 	case ACTION_MESSAGE:
-		logmsg := now() + " *" + strings.Join(msg, " ") + "*"
 		nick, msg := msg[0], strings.Join(msg[1:], " ")
+		logmsg := now() + " *" + nick + " " + msg + "*"
+		logline := &chatLogLine{ACTION_MESSAGE, strings.TrimLeft(nick, "~&@%+"), msg, logmsg}
+		msg = filter(msg)
 		h := hl(nick, msg)
 		if h && !mainWindowFocused {
-			systray.ShowMessage("", logmsg)
+			systray.ShowMessage("", now()+" *"+nick+" "+msg+"*")
 		}
 		for _, tab := range tabs {
 			nick := colorNick(tab, h, nick)
 			tab.Notify(h)
-			tab.Logln(logmsg)
+			tab.Logln(logline)
 			tab.Println(parseString(actionMsg(h, nick, msg)))
 		}
 	default:
@@ -160,22 +170,26 @@ func Println(msgType int, tabs []tabWithTextBuffer, msg ...string) {
 	case SERVER_MESSAGE:
 		text, styles := parseString(serverMsg(msg...))
 		for _, tab := range tabs {
-			tab.Logln(text)
+			tab.Logln(&chatLogLine{Type: msgType, Raw: strings.Join(msg, " "), Line: text})
 			tab.Println(text, styles)
 		}
 
 	case SERVER_ERROR:
 		text, styles := parseString(serverErrorMsg(msg...))
 		for _, tab := range tabs {
-			tab.Logln(text)
+			tab.Logln(&chatLogLine{Type: msgType, Raw: strings.Join(msg, " "), Line: text})
 			tab.Errorln(text, styles)
 		}
 
 	case JOINPART_MESSAGE:
 		if !clientCfg.HideJoinParts {
 			text, styles := parseString(joinpartMsg(msg...))
+			logline := &chatLogLine{Type: msgType, Raw: strings.Join(msg, " "), Line: text}
+			if len(msg) > 1 {
+				logline.Nick = msg[1] // "->" nick ...
+			}
 			for _, tab := range tabs {
-				tab.Logln(text)
+				tab.Logln(logline)
 				tab.Println(text, styles)
 			}
 		}
@@ -184,35 +198,35 @@ func Println(msgType int, tabs []tabWithTextBuffer, msg ...string) {
 		// TODO(tso): option to hide?
 		text, styles := parseString(updateMsg(msg...))
 		for _, tab := range tabs {
-			tab.Logln(text)
+			tab.Logln(&chatLogLine{Type: msgType, Raw: strings.Join(msg, " "), Line: text})
 			tab.Println(text, styles)
 		}
 
 	case NOTICE_MESSAGE:
 		for _, tab := range tabs {
 			tab.Notify(true)
-			tab.Logln(now() + " *** NOTICE: " + strings.Join(msg, " "))
+			tab.Logln(noticeLogLine(msg))
 			tab.Println(parseString(noticeMsg(false, msg...)))
 		}
 
 	case PRIVATE_MESSAGE:
 		nick, msg := msg[0], strings.Join(msg[1:], " ")
-		logmsg := now() + " <" + nick + "> " + msg
+		logline := &chatLogLine{PRIVATE_MESSAGE, strings.TrimLeft(nick, "~&@%+"), msg, now() + " <" + nick + "> " + msg}
 		for _, tab := range tabs {
 			nick := colorNick(tab, false, nick)
 			nick = leftpadNick(tab, nick)
 			tab.Notify(false)
-			tab.Logln(logmsg)
+			tab.Logln(logline)
 			tab.Println(parseString(privateMsg(false, nick, msg)))
 		}
 
 	case ACTION_MESSAGE:
-		logmsg := now() + " *" + strings.Join(msg, " ") + "*"
+		logline := &chatLogLine{ACTION_MESSAGE, strings.TrimLeft(msg[0], "~&@%+"), strings.Join(msg[1:], " "), now() + " *" + strings.Join(msg, " ") + "*"}
 		nick, msg := msg[0], strings.Join(msg[1:], " ")
 		for _, tab := range tabs {
 			nick := colorNick(tab, false, nick)
 			tab.Notify(false)
-			tab.Logln(logmsg)
+			tab.Logln(logline)
 			tab.Println(parseString(actionMsg(false, nick, msg)))
 		}
 
@@ -227,6 +241,17 @@ func Println(msgType int, tabs []tabWithTextBuffer, msg ...string) {
 	}
 }
 
+// noticeLogLine is msg (nick, target, text...) for the chat log
+func noticeLogLine(msg []string) *chatLogLine {
+	line := &chatLogLine{Type: NOTICE_MESSAGE, Line: now() + " *** NOTICE: " + strings.Join(msg, " ")}
+	if len(msg) >= 3 {
+		line.Nick, line.Raw = msg[0], strings.Join(msg[2:], " ")
+	} else {
+		line.Raw = strings.Join(msg, " ")
+	}
+	return line
+}
+
 func clientMsg(text ...string) string {
 	return color(strings.Join(text, " "), DarkGrey)
 }
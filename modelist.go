@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// list modes: +b (ban), +e (ban exception) and +I (invite exception)
+//
+// RPL_BANLIST       367 <nick> <channel> <mask> [<who> <set-ts>]
+// RPL_ENDOFBANLIST  368
+// RPL_EXCEPTLIST    348 <nick> <channel> <mask> [<who> <set-ts>]
+// RPL_ENDOFEXCEPT   349
+// RPL_INVITELIST    346 <nick> <channel> <mask> [<who> <set-ts>]
+// RPL_ENDOFINVITE   347
+
+type modeListEntry struct {
+	mask   string
+	setter string
+	at     time.Time
+}
+
+type modeList struct {
+	mode    byte
+	entries []*modeListEntry
+
+	// receiving is true between the first list reply and the end of list,
+	// complete is true once we've gotten the whole list from the server at
+	// least once. after that MODE changes keep it current.
+	receiving, complete bool
+
+	// what to print when the end of list arrives (see /bans [search])
+	pendingSearch string
+
+	mu *sync.Mutex
+}
+
+func newModeList(mode byte) *modeList {
+	return &modeList{
+		mode:    mode,
+		entries: []*modeListEntry{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (ml *modeList) Name() string {
+	switch ml.mode {
+	case 'b':
+		return "ban"
+	case 'e':
+		return "ban exception"
+	case 'I':
+		return "invite exception"
+	}
+	return "+" + string(ml.mode)
+}
+
+// Receive is called for each list reply numeric. the first reply after an
+// end of list wipes whatever we had before so stale entries don't linger.
+func (ml *modeList) Receive(mask, setter string, at time.Time) {
+	ml.mu.Lock()
+	if !ml.receiving {
+		ml.entries = []*modeListEntry{}
+		ml.receiving = true
+	}
+	ml.mu.Unlock()
+	ml.Add(mask, setter, at)
+}
+
+func (ml *modeList) End() {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if !ml.receiving {
+		// empty list
+		ml.entries = []*modeListEntry{}
+	}
+	ml.receiving = false
+	ml.complete = true
+}
+
+func (ml *modeList) Add(mask, setter string, at time.Time) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	for _, e := range ml.entries {
+		if strings.EqualFold(e.mask, mask) {
+			e.setter, e.at = setter, at
+			return
+		}
+	}
+	ml.entries = append(ml.entries, &modeListEntry{mask, setter, at})
+}
+
+func (ml *modeList) Remove(mask string) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	for i, e := range ml.entries {
+		if strings.EqualFold(e.mask, mask) {
+			ml.entries = append(ml.entries[0:i], ml.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ml *modeList) Clear() {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.entries = []*modeListEntry{}
+	ml.receiving = false
+	ml.complete = false
+}
+
+// Complete is whether we have the whole list, see complete
+func (ml *modeList) Complete() bool {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	return ml.complete
+}
+
+// SetPendingSearch is for /bans [search] while we're waiting for the list
+func (ml *modeList) SetPendingSearch(search string) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.pendingSearch = search
+}
+
+// TakePendingSearch returns the pending search and forgets it
+func (ml *modeList) TakePendingSearch() string {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	search := ml.pendingSearch
+	ml.pendingSearch = ""
+	return search
+}
+
+func (ml *modeList) Len() int {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	return len(ml.entries)
+}
+
+// Search returns entries (oldest first) whose mask matches search.
+// search containing * or ? is matched as a wildcard mask, anything else is a
+// case-insensitive substring of either the mask or the setter. empty search
+// returns everything.
+func (ml *modeList) Search(search string) []*modeListEntry {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	wildcard := strings.ContainsAny(search, "*?")
+	search = strings.ToLower(search)
+
+	res := []*modeListEntry{}
+	for _, e := range ml.entries {
+		switch {
+		case search == "":
+		case wildcard:
+			if !matchMask(search, e.mask) {
+				continue
+			}
+		default:
+			if !strings.Contains(strings.ToLower(e.mask), search) &&
+				!strings.Contains(strings.ToLower(e.setter), search) {
+				continue
+			}
+		}
+		res = append(res, &modeListEntry{e.mask, e.setter, e.at})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].at.Before(res[j].at)
+	})
+	return res
+}
+
+// OlderThan filters the result of Search to entries set more than d ago.
+// entries without a timestamp are never considered old.
+func (ml *modeList) OlderThan(search string, d time.Duration) []*modeListEntry {
+	cutoff := time.Now().Add(-d)
+	res := []*modeListEntry{}
+	for _, e := range ml.Search(search) {
+		if !e.at.IsZero() && e.at.Before(cutoff) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func (chanState *channelState) modeList(mode byte) *modeList {
+	switch mode {
+	case 'b':
+		return chanState.banList
+	case 'e':
+		return chanState.exceptList
+	case 'I':
+		return chanState.inviteList
+	}
+	return nil
+}
+
+func printModeList(tab tabWithTextBuffer, chanState *channelState, ml *modeList, search string) {
+	entries := ml.Search(search)
+	matching := ""
+	if search != "" {
+		matching = " matching " + search
+	}
+	if len(entries) == 0 {
+		clientMessage(tab, now(), "no "+pluralize(ml.Name(), 0)+" for "+chanState.channel+matching)
+		return
+	}
+	clientMessage(tab, now(), fmt.Sprintf("%d %s for %s%s:",
+		len(entries), pluralize(ml.Name(), len(entries)), chanState.channel, matching))
+	for i, e := range entries {
+		line := fmt.Sprintf("%3d. %s", i+1, e.mask)
+		if e.setter != "" {
+			line += color(" set by "+e.setter, LightGrey)
+		}
+		if !e.at.IsZero() {
+			line += color(" on "+e.at.Format("2006-01-02 15:04")+" ("+humanDuration(time.Since(e.at))+" ago)", LightGrey)
+		}
+		clientMessage(tab, line)
+	}
+}
+
+// modesPerLine is how many parameterized modes we can put in one MODE
+// command, the server tells us in ISUPPORT MODES=n
+func (servConn *serverConnection) modesPerLine() int {
+	if n, err := strconv.Atoi(servConn.isupport["MODES"]); err == nil && n > 0 {
+		return n
+	}
+	return 3
+}
+
+// sendModeList sets or unsets mode for each mask, batching as many as the
+// server allows per line e.g. MODE #channel -bbb mask1 mask2 mask3
+func sendModeList(servConn *serverConnection, channel string, add bool, mode byte, masks []string) {
+	sign := "-"
+	if add {
+		sign = "+"
+	}
+	n := servConn.modesPerLine()
+	for len(masks) > 0 {
+		batch := masks
+		if len(batch) > n {
+			batch = masks[:n]
+		}
+		masks = masks[len(batch):]
+		modes := sign + strings.Repeat(string(mode), len(batch))
+		servConn.conn.Mode(channel, append([]string{modes}, batch...)...)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModeList(t *testing.T) {
+	ml := newModeList('b')
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	ml.Receive("*!*@stale.example.com", "tso", recent)
+	ml.End()
+	if !ml.Complete() {
+		t.Fatal("expected the list to be complete after the end of list")
+	}
+
+	// a fresh list from the server replaces what we had
+	ml.Receive("*!*@spam.example.com", "tso", recent)
+	ml.Receive("badnick!*@*", "ChanServ", old)
+	ml.Receive("*!*@SPAM.example.com", "bob", recent) // same mask, updates it
+	ml.Receive("*!*@notimestamp.org", "", time.Time{})
+	ml.End()
+	if ml.Len() != 3 {
+		t.Fatalf("expected 3 entries got %d", ml.Len())
+	}
+
+	masks := func(entries []*modeListEntry) string {
+		s := []string{}
+		for _, e := range entries {
+			s = append(s, e.mask)
+		}
+		return strings.Join(s, " ")
+	}
+	for _, test := range []struct {
+		search, expected string
+	}{
+		{"", "*!*@notimestamp.org badnick!*@* *!*@spam.example.com"},
+		{"SPAM", "*!*@spam.example.com"},
+		{"chanserv", "badnick!*@*"},
+		{"*!*@*.org", "*!*@notimestamp.org"},
+		{"nothing", ""},
+	} {
+		if got := masks(ml.Search(test.search)); got != test.expected {
+			t.Errorf("Search(%q): expected %q got %q", test.search, test.expected, got)
+		}
+	}
+	if got := masks(ml.OlderThan("", 24*time.Hour)); got != "badnick!*@*" {
+		t.Errorf("OlderThan: expected badnick!*@* got %q", got)
+	}
+
+	ml.Remove("BADNICK!*@*")
+	if ml.Len() != 2 {
+		t.Errorf("expected 2 entries after Remove got %d", ml.Len())
+	}
+
+	empty := newModeList('e')
+	empty.End()
+	if empty.Len() != 0 || !empty.Complete() {
+		t.Error("expected an empty list to be complete")
+	}
+
+	ml.SetPendingSearch("spam")
+	if s := ml.TakePendingSearch(); s != "spam" {
+		t.Errorf("expected pending search spam got %q", s)
+	}
+	if s := ml.TakePendingSearch(); s != "" {
+		t.Errorf("expected pending search to be cleared got %q", s)
+	}
+
+	ml.Clear()
+	if ml.Complete() || ml.Len() != 0 {
+		t.Error("expected Clear to empty the list")
+	}
+}
@@ -9,7 +9,8 @@ import (
 
 type nick struct {
 	prefix, name string
-	host         string
+	user, host   string
+	account      string
 }
 
 func (n *nick) String() string {
@@ -23,7 +24,7 @@ var nickRegex = regexp.MustCompile("^([~&@%+]*)(.+)$")
 
 func newNick(prefixed string) *nick {
 	m := nickRegex.FindAllStringSubmatch(prefixed, -1)
-	return &nick{m[0][1], m[0][2], ""}
+	return &nick{m[0][1], m[0][2], "", "", ""}
 }
 
 type nickList struct {
@@ -41,13 +42,35 @@ func newNickList() *nickList {
 	return nl
 }
 
-func (nl *nickList) SetHost(nick, host string) {
+func (nl *nickList) SetUserHost(nick, user, host string) {
 	nl.mu.Lock()
 	defer nl.mu.Unlock()
 
 	n, ok := nl.lookup[nick]
 	if ok {
-		n.host = host
+		n.user, n.host = user, host
+	}
+}
+
+// UserHost is user@host for nick if we know it
+func (nl *nickList) UserHost(nick string) string {
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+
+	n, ok := nl.lookup[nick]
+	if !ok || n.host == "" {
+		return ""
+	}
+	return n.user + "@" + n.host
+}
+
+func (nl *nickList) SetAccount(nick, account string) {
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+
+	n, ok := nl.lookup[nick]
+	if ok {
+		n.account = account
 	}
 }
 
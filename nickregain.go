@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// altNickFunc replaces goirc's 433 handler nick picker (and is used for
+// 436/437 which goirc doesn't handle at all). we go through the configured
+// alternate nicks in order and then fall back to sticking ^ on the end.
+func altNickFunc(servState *serverState, primary string, alts []string) func(string) string {
+	return func(failed string) string {
+		// goirc calls this for every 433 including when we /nick to
+		// something that's taken after we're connected, in which case we
+		// stay who we are. goirc sends NICK with whatever we return so the
+		// server says 431 about the empty one, see the ERR_ handlers.
+		if servState.connState == CONNECTED {
+			return ""
+		}
+		candidates := append([]string{primary}, alts...)
+		for i, n := range candidates {
+			if strings.EqualFold(n, failed) && i+1 < len(candidates) {
+				return candidates[i+1]
+			}
+		}
+		return failed + "^"
+	}
+}
+
+// nickRegainer gets our primary nick back after we've connected with an
+// alternate because the primary was in use (e.g. our own ghost after a
+// netsplit or ping timeout).
+//
+// if we have a nickserv password we GHOST whoever has it, then either way
+// we wait for it to become free by watching QUIT and NICK in channels we
+// share and by asking the server to tell us with MONITOR if it's supported.
+type nickRegainer struct {
+	servConn  *serverConnection
+	servState *serverState
+
+	primary  string
+	password string
+
+	active     bool
+	monitoring bool
+	mu         *sync.Mutex
+
+	// how we talk to the server and tell the user, tests replace these
+	raw    func(line string)
+	notify func(msg string)
+}
+
+func newNickRegainer(servConn *serverConnection, servState *serverState, primary, password string) *nickRegainer {
+	return &nickRegainer{
+		servConn:  servConn,
+		servState: servState,
+		primary:   primary,
+		password:  password,
+		mu:        &sync.Mutex{},
+		raw:       func(line string) { servConn.conn.Raw(line) },
+		notify:    func(msg string) { clientMessage(servState.tab, now(), msg) },
+	}
+}
+
+func (r *nickRegainer) have() bool {
+	return strings.EqualFold(r.servState.user.nick, r.primary)
+}
+
+// Start is called at the end of the MOTD, after ISUPPORT so we know whether
+// there's MONITOR. a /motd later on does nothing since we're already active
+// or have the nick.
+func (r *nickRegainer) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.have() || r.active {
+		return
+	}
+	r.active = true
+
+	r.notify("nick " + r.primary + " is in use, trying to regain it...")
+
+	if _, ok := r.servConn.isupport["MONITOR"]; ok {
+		r.monitoring = true
+		r.raw("MONITOR + " + r.primary)
+	}
+	if r.password != "" {
+		r.raw("PRIVMSG NickServ :GHOST " + r.primary + " " + r.password)
+		if !r.monitoring {
+			// no way to find out when the ghost is gone unless we share a
+			// channel with it so just try in a bit
+			go func() {
+				<-time.After(time.Second * 3)
+				r.Gone(r.primary)
+			}()
+		}
+	}
+}
+
+// Gone is called when nick quits, changes nick, or MONITOR says it's offline
+func (r *nickRegainer) Gone(nick string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.active || !strings.EqualFold(nick, r.primary) || r.have() {
+		return
+	}
+	r.raw("NICK " + r.primary)
+}
+
+// Check is called whenever our nick changes
+func (r *nickRegainer) Check() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.active || !r.have() {
+		return
+	}
+	r.active = false
+	if r.monitoring {
+		r.monitoring = false
+		r.raw("MONITOR - " + r.primary)
+	}
+	r.notify("regained nick " + r.primary)
+}
+
+// Reset is called on disconnect, we start over with the primary nick
+func (r *nickRegainer) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active = false
+	r.monitoring = false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAltNickFunc(t *testing.T) {
+	servState := &serverState{user: &userState{nick: "tso"}}
+	newNick := altNickFunc(servState, "tso", []string{"tso_", "tso__"})
+	for _, test := range []struct {
+		failed, expected string
+	}{
+		{"tso", "tso_"},
+		{"TSO_", "tso__"},
+		{"tso__", "tso__^"},
+		{"tso__^", "tso__^^"},
+		{"someone", "someone^"},
+	} {
+		if got := newNick(test.failed); got != test.expected {
+			t.Errorf("%q: expected %q got %q", test.failed, test.expected, got)
+		}
+	}
+
+	servState.connState = CONNECTED
+	if got := newNick("taken"); got != "" {
+		t.Errorf("connected: expected no new nick got %q", got)
+	}
+}
+
+func TestNickRegainer(t *testing.T) {
+	for _, test := range []struct {
+		isupport map[string]string
+		password string
+		expected []string
+	}{
+		{
+			map[string]string{"MONITOR": "100"}, "hunter2",
+			[]string{"MONITOR + tso", "PRIVMSG NickServ :GHOST tso hunter2", "NICK tso", "MONITOR - tso"},
+		},
+		{
+			map[string]string{}, "",
+			[]string{"NICK tso"},
+		},
+	} {
+		servState := &serverState{user: &userState{nick: "tso_"}}
+		sent := []string{}
+		r := &nickRegainer{
+			servConn:  &serverConnection{isupport: test.isupport},
+			servState: servState,
+			primary:   "tso",
+			password:  test.password,
+			mu:        &sync.Mutex{},
+			raw:       func(line string) { sent = append(sent, line) },
+			notify:    func(string) {},
+		}
+
+		r.Gone("tso") // not started yet
+		r.Start()
+		r.Start() // already going
+		r.Gone("someone")
+		r.Gone("TSO")
+		servState.user.nick = "tso"
+		r.Check()
+		r.Check()
+		r.Gone("tso") // got it already
+
+		if strings.Join(sent, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("expected\n%s\ngot\n%s", strings.Join(test.expected, "\n"), strings.Join(sent, "\n"))
+		}
+
+		// nothing to do when we have it
+		sent = []string{}
+		r.Reset()
+		r.Start()
+		if len(sent) != 0 {
+			t.Errorf("expected nothing sent when we have the nick, got %q", sent)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// some servers can do ignores for us so the messages never even reach us.
+// SILENCE takes nick!user@host masks like our own ignores do. CALLERID is
+// usermode +g, which blocks private messages from everyone who isn't on our
+// ACCEPT list, see /callerid and /accept.
+
+// hasSilence is whether the server supports SILENCE
+func (servConn *serverConnection) hasSilence() bool {
+	_, ok := servConn.isupport["SILENCE"]
+	return ok
+}
+
+// callerIDMode is the usermode for CALLERID, usually g, or 0 if the server
+// doesn't support it
+func (servConn *serverConnection) callerIDMode() byte {
+	v, ok := servConn.isupport["CALLERID"]
+	if !ok {
+		return 0
+	}
+	if v == "" {
+		return 'g'
+	}
+	return v[0]
+}
+
+// serverIgnore makes the server ignore (or stop ignoring) ig for us with
+// SILENCE. CALLERID (+g) can't do this: taking someone off the ACCEPT list
+// does nothing unless they were on it and we're +g already.
+func (servConn *serverConnection) serverIgnore(ig *ignoreEntry, on bool) error {
+	if !servConn.hasSilence() {
+		return fmt.Errorf("this server doesn't support SILENCE")
+	}
+	sign := "+"
+	if !on {
+		sign = "-"
+	}
+	servConn.conn.Raw("SILENCE " + sign + ig.Mask)
+	return nil
+}
+
+// silenceTimers are when to take server side ignores off again, one per
+// mask so putting them back when we reconnect doesn't set up another
+type silenceTimers struct {
+	timers map[string]*time.Timer
+	mu     *sync.Mutex
+}
+
+func newSilenceTimers() *silenceTimers {
+	return &silenceTimers{timers: map[string]*time.Timer{}, mu: &sync.Mutex{}}
+}
+
+// Set calls fn after d, instead of whatever was set for mask before
+func (st *silenceTimers) Set(mask string, d time.Duration, fn func()) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := strings.ToLower(mask)
+	if old, ok := st.timers[key]; ok {
+		old.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		st.mu.Lock()
+		if st.timers[key] != timer {
+			// replaced or stopped since
+			st.mu.Unlock()
+			return
+		}
+		delete(st.timers, key)
+		st.mu.Unlock()
+		fn()
+	})
+	st.timers[key] = timer
+}
+
+// StopAll is for when we disconnect, the server has forgotten them anyway
+func (st *silenceTimers) StopAll() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key, timer := range st.timers {
+		timer.Stop()
+		delete(st.timers, key)
+	}
+}
+
+// serverIgnoreExpires takes ig off the server when it runs out, unless
+// we've disconnected or ignored the same mask again since
+func (servConn *serverConnection) serverIgnoreExpires(ig *ignoreEntry) {
+	if ig.Expires == nil {
+		return
+	}
+	servConn.silenceExpiry.Set(ig.Mask, time.Until(*ig.Expires), func() {
+		if !servConn.conn.Connected() {
+			return
+		}
+		for _, other := range ignoreList.List() {
+			if other.Server && strings.EqualFold(other.Mask, ig.Mask) {
+				return
+			}
+		}
+		servConn.serverIgnore(ig, false)
+	})
+}
+
+// syncServerIgnores puts our server side ignores back when we connect since
+// the server forgets them when we leave
+func (servConn *serverConnection) syncServerIgnores(network string) {
+	if !servConn.hasSilence() {
+		return
+	}
+	for _, ig := range ignoreList.List() {
+		if ig.Server && (ig.Network == "" || strings.EqualFold(ig.Network, network)) {
+			servConn.serverIgnore(ig, true)
+			servConn.serverIgnoreExpires(ig)
+		}
+	}
+}
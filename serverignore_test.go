@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSilenceTimers(t *testing.T) {
+	st := newSilenceTimers()
+	fired := make(chan string, 10)
+	st.Set("spammer!*@*", time.Millisecond*20, func() { fired <- "first" })
+	st.Set("SPAMMER!*@*", time.Millisecond*20, func() { fired <- "second" })
+	st.Set("other!*@*", time.Millisecond*20, func() { fired <- "other" })
+	got := map[string]bool{}
+	timeout := time.After(time.Millisecond * 100)
+	for done := false; !done; {
+		select {
+		case f := <-fired:
+			got[f] = true
+		case <-timeout:
+			done = true
+		}
+	}
+	if got["first"] || !got["second"] || !got["other"] || len(got) != 2 {
+		t.Errorf("expected second and other to fire, got %v", got)
+	}
+
+	fired = make(chan string, 10)
+	st.Set("spammer!*@*", time.Millisecond*20, func() { fired <- "spammer" })
+	st.StopAll()
+	select {
+	case f := <-fired:
+		t.Errorf("expected nothing to fire after StopAll, got %q", f)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
@@ -6,15 +6,53 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"sync"
 )
 
 type connectionConfig struct {
-	Host             string   `json:"host"`
-	Port             int      `json:"port"`
-	Ssl              bool     `json:"ssl"`
-	Nick             string   `json:"nick"`
-	NickServPASSWORD string   `json:"nickserv_password"`
-	AutoJoin         []string `json:"autojoin"`
+	Host             string             `json:"host"`
+	Port             int                `json:"port"`
+	Ssl              bool               `json:"ssl"`
+	Nick             string             `json:"nick"`
+	AltNicks         []string           `json:"altnicks"`
+	NickServPASSWORD string             `json:"nickserv_password"`
+	AutoJoin         []*autojoinChannel `json:"autojoin"`
+}
+
+// autojoinChannel is a channel with an optional key, in config.json it's
+// either "#channel" or {"channel": "#channel", "key": "hunter2"}
+type autojoinChannel struct {
+	Channel string `json:"channel"`
+	Key     string `json:"key,omitempty"`
+}
+
+func (ch *autojoinChannel) UnmarshalJSON(b []byte) error {
+	var channel string
+	if err := json.Unmarshal(b, &channel); err == nil {
+		ch.Channel = channel
+		return nil
+	}
+	type plain autojoinChannel
+	return json.Unmarshal(b, (*plain)(ch))
+}
+
+func (ch *autojoinChannel) MarshalJSON() ([]byte, error) {
+	if ch.Key == "" {
+		return json.Marshal(ch.Channel)
+	}
+	type plain autojoinChannel
+	return json.Marshal((*plain)(ch))
+}
+
+// findConnectionConfig returns the autoconnect entry for host:port, or nil
+// for connections opened with /server
+func findConnectionConfig(host string, port int) *connectionConfig {
+	for _, cfg := range clientCfg.AutoConnect {
+		if cfg.Host == host && cfg.Port == port {
+			return cfg
+		}
+	}
+	return nil
 }
 
 type clientConfig struct {
@@ -28,6 +66,53 @@ type clientConfig struct {
 	TimeFormat      string              `json:"timeformat"`
 	Version         string              `json:"version"`
 	QuitMessage     string              `json:"quitmessage"`
+	CTCP            ctcpConfig          `json:"ctcp"`
+	DownloadDir     string              `json:"downloaddir"`
+	DccPassive      string              `json:"dccpassive"`
+
+	// the address people should connect to for DCC, if you're behind NAT
+	// and the server doesn't show your real host
+	DccAddress string `json:"dccaddress"`
+
+	// bandwidth limits per second for all transfers together and for each
+	// one e.g. "1M", "200K", and how many files we send at once, the rest
+	// wait their turn. empty or 0 means no limit
+	DccRate         string `json:"dccrate"`
+	DccTransferRate string `json:"dcctransferrate"`
+	DccMaxSends     int    `json:"dccmaxsends"`
+
+	// offers from nick!user@host masks that match these are accepted
+	// without asking, unless they're blocked by extension or size
+	DccAutoAccept []string `json:"dccautoaccept"`
+	// files with these extensions are turned down, leave it out for a
+	// sensible default list of executables or set it to [] to allow all
+	DccBlockedExtensions []string `json:"dccblockedextensions"`
+	// largest file we'll accept e.g. "2G", empty means no limit
+	DccMaxSize string `json:"dccmaxsize"`
+
+	// see /ignore
+	Ignores []*ignoreEntry `json:"ignores"`
+	// see /highlight
+	Highlight highlightConfig `json:"highlight"`
+	// see /filter
+	WordFilters []*wordFilter `json:"wordfilters"`
+	// automatically ignores spammers for a while, see floodConfig
+	Flood floodConfig `json:"flood"`
+
+	// chat logs go in chatlogs/network/channel/2006-01-02.log (or .jsonl...), a new
+	// one every midnight "local" (the default) or "server" time
+	ChatLogRotate string `json:"chatlogrotate"`
+	// any of "text" (the default), "json" for one json object per line,
+	// "irssi" or "weechat" separated by commas. "both" is text and json.
+	ChatLogFormat string `json:"chatlogformat"`
+	// gzip logs from before yesterday
+	ChatLogCompress bool `json:"chatlogcompress"`
+	// delete logs older than this many days, 0 keeps them forever
+	ChatLogRetention int `json:"chatlogretention"`
+
+	// how long to wait before trying to join a full (+l) channel again,
+	// e.g. "30s" or "5m", empty means don't
+	FullChannelRetry string `json:"fullchannelretry"`
 }
 
 func defaultClientConfig() *clientConfig {
@@ -58,7 +143,13 @@ func getClientConfig() (*clientConfig, error) {
 	return cfg, err
 }
 
+// clientConfigMu is held while writing config.json, ignores, highlights and
+// word filters all save it from their own goroutines
+var clientConfigMu = &sync.Mutex{}
+
 func writeClientConfig() error {
+	clientConfigMu.Lock()
+	defer clientConfigMu.Unlock()
 	f, err := os.Create("config.json")
 	if err == nil {
 		b, err := json.MarshalIndent(clientCfg, "", "    ")
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"sync"
+	"time"
+)
+
 type userState struct {
 	nick string
 	// other stuff like OPER...
@@ -21,11 +26,14 @@ type serverState struct {
 	port        int
 	ssl         bool
 	networkName string
+	serverTime  *time.Location // from TIME, see chatLogLocation()
 	user        *userState
 	channels    map[string]*channelState
 	privmsgs    map[string]*privmsgState
 	tab         *tabServer
 	channelList *tabChannelList
+	transfers   *tabTransfers
+	xdcc        *tabXdcc
 }
 
 func (servState *serverState) AllTabs() []tabWithTextBuffer {
@@ -46,22 +54,46 @@ func (servState *serverState) CurrentTab() tabWithTextBuffer {
 
 type channelState struct {
 	channel  string
+	key      string
 	topic    string
 	nickList *nickList
 	tab      *tabChannel
+
+	banList    *modeList
+	exceptList *modeList
+	inviteList *modeList
 }
 
 type privmsgState struct {
-	nick string
-	tab  *tabPrivmsg
+	nick     string
+	userhost string // for the logs, see UserHost
+	tab      *tabPrivmsg
+	mu       *sync.Mutex
+}
+
+// UserHost is read by the chat logger from its own goroutine
+func (pmState *privmsgState) UserHost() string {
+	pmState.mu.Lock()
+	defer pmState.mu.Unlock()
+	return pmState.userhost
+}
+
+func (pmState *privmsgState) SetUserHost(userhost string) {
+	pmState.mu.Lock()
+	defer pmState.mu.Unlock()
+	pmState.userhost = userhost
 }
 
 func ensureChanState(servConn *serverConnection, servState *serverState, channel string) *channelState {
 	chanState, ok := servState.channels[channel]
 	if !ok {
 		chanState = &channelState{
-			channel:  channel,
-			nickList: newNickList(),
+			channel:    channel,
+			key:        servConn.joinKey(channel),
+			nickList:   newNickList(),
+			banList:    newModeList('b'),
+			exceptList: newModeList('e'),
+			inviteList: newModeList('I'),
 		}
 
 		// TODO(tso): make a finderFunc instead
@@ -91,6 +123,7 @@ func ensurePmState(servConn *serverConnection, servState *serverState, nick stri
 	if !ok {
 		pmState = &privmsgState{
 			nick: nick,
+			mu:   &sync.Mutex{},
 		}
 
 		// TODO(tso): make a finderFunc instead
@@ -150,12 +150,15 @@ func newChannelTab(servConn *serverConnection, servState *serverState, chanState
 	t.topicInput = &walk.LineEdit{}
 
 	t.send = func(msg string) {
+		msg = wordFilters.Apply(FILTER_OUT, chanState.channel, msg)
 		servConn.conn.Privmsg(chanState.channel, msg)
 		nick := chanState.nickList.Get(servState.user.nick)
 		privateMessage(t, nick.String(), msg)
 	}
 
-	t.chatlogger = NewChatLogger(servState.networkName + "-" + chanState.channel)
+	t.chatlogger = NewChatLogger(servState, chanState.channel, func(nick string) string {
+		return chanState.nickList.UserHost(nick)
+	})
 
 	t.nickListHidden = false
 	t.nickListBoxSize = walk.Size{}
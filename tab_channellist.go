@@ -114,7 +114,7 @@ func NewChannelList(servConn *serverConnection, servState *serverState) *tabChan
 			},
 			OnItemActivated: func() {
 				channel := t.mdl.items[tbl.CurrentIndex()].channel
-				servConn.conn.Join(channel)
+				servConn.Join(&autojoinChannel{Channel: channel})
 			},
 		}.Create(builder)
 
@@ -18,7 +18,7 @@ type tabChatbox struct {
 	notify       bool
 	textBuffer   *RichEdit
 	textInput    *MyLineEdit
-	chatlogger   func(string)
+	chatlogger   *chatLogger
 
 	nickQueue *nickQueue
 }
@@ -84,8 +84,13 @@ func (t *tabChatbox) Focus() {
 	})
 }
 
-func (t *tabChatbox) Logln(text string) {
-	t.chatlogger(text)
+func (t *tabChatbox) Logln(line *chatLogLine) {
+	t.chatlogger.Println(line)
+}
+
+func (t *tabChatbox) Close() {
+	t.chatlogger.Close()
+	t.tabCommon.Close()
 }
 
 func (t *tabChatbox) Errorln(text string, styles [][]int) {
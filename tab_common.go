@@ -26,7 +26,7 @@ type tabWithTextBuffer interface {
 	Padlen(string) int    // just shoehorning this in here for now
 	NickColor(string) int // ditto
 
-	Logln(string)            // chatlogging
+	Logln(*chatLogLine)      // chatlogging
 	Errorln(string, [][]int) // print error to buffer
 	Println(string, [][]int) // print text to buffer
 	// TODO(tso): better name for Notify/t.notify/asterisk what are words
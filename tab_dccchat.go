@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math/rand"
+
+	"github.com/lxn/walk"
+	"github.com/lxn/win"
+)
+
+// tabDccChat is a private conversation over a direct connection instead of
+// through the server. it looks and behaves like a tabPrivmsg.
+type tabDccChat struct {
+	tabChatbox
+	chat      *dccChat
+	nickColor func(string) int
+}
+
+func (t *tabDccChat) NickColor(nick string) int {
+	return t.nickColor(nick)
+}
+
+func (t *tabDccChat) Send(message string) {
+	message = wordFilters.Apply(FILTER_OUT, t.chat.nick, message)
+	if err := t.chat.Send(message); err != nil {
+		clientError(t, now(), "ERROR: not sent: "+err.Error())
+		return
+	}
+	nick := newNick(t.chat.servState.user.nick)
+	privateMessage(t, nick.String(), message)
+}
+
+func (t *tabDccChat) Update(servState *serverState) {
+	t.disconnected = !t.chat.Connected()
+	t.statusIcon = servState.tab.statusIcon
+	t.statusText = "DCC CHAT with " + t.chat.nick
+	if t.tabPage != nil {
+		mw.WindowBase.Synchronize(func() {
+			t.tabPage.SetTitle(t.Title())
+			if t.HasFocus() {
+				SetStatusBarIcon(t.statusIcon)
+				SetStatusBarText(t.statusText)
+			}
+		})
+	}
+
+	SetSystrayContextMenu()
+}
+
+func newDccChatTab(servConn *serverConnection, servState *serverState, chat *dccChat) *tabDccChat {
+	t := &tabDccChat{chat: chat}
+	// mIRC calls these =nick so do we
+	t.tabTitle = "=" + chat.nick
+	t.statusText = "DCC CHAT with " + chat.nick
+
+	color := rand.Intn(98)
+	t.nickColor = func(nick string) int {
+		if nick == servState.user.nick {
+			return DarkGray
+		}
+		return color
+	}
+
+	t.chatlogger = NewChatLogger(servState, "="+chat.nick, nil)
+
+	ctx := tabMan.Create(&tabContext{servConn: servConn, servState: servState}, servState.tab.Index()+1)
+	ctx.tab = t
+
+	mw.WindowBase.Synchronize(func() {
+		var err error
+		t.tabPage, err = walk.NewTabPage()
+		checkErr(err)
+		t.tabPage.SetTitle(t.tabTitle)
+		t.tabPage.SetLayout(walk.NewVBoxLayout())
+		t.textBuffer, err = NewRichEdit(t.tabPage)
+		checkErr(err)
+		t.textInput = NewTextInput(t)
+		checkErr(t.tabPage.Children().Add(t.textInput))
+
+		// remove borders
+		win.SetWindowLong(t.textInput.Handle(), win.GWL_EXSTYLE, 0)
+
+		{
+			index := servState.tab.Index()
+			if servState.channelList != nil {
+				index = servState.channelList.Index()
+			}
+			for _, ch := range servState.channels {
+				i := ch.tab.Index()
+				if i > index {
+					index = i
+				}
+			}
+			for _, pm := range servState.privmsgs {
+				i := pm.tab.Index()
+				if i > index {
+					index = i
+				}
+			}
+			index++
+
+			checkErr(tabWidget.Pages().Insert(index, t.tabPage))
+		}
+		tabWidget.SaveState()
+	})
+
+	mw.Synchronize(func() {
+		applyThemeToTab(t)
+	})
+	return t
+}
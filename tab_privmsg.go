@@ -43,6 +43,7 @@ func newPrivmsgTab(servConn *serverConnection, servState *serverState, pmState *
 	t.tabTitle = pmState.nick
 
 	t.send = func(msg string) {
+		msg = wordFilters.Apply(FILTER_OUT, pmState.nick, msg)
 		servConn.conn.Privmsg(pmState.nick, msg)
 		nick := newNick(servState.user.nick)
 		privateMessage(t, nick.String(), msg)
@@ -56,7 +57,12 @@ func newPrivmsgTab(servConn *serverConnection, servState *serverState, pmState *
 		return color
 	}
 
-	t.chatlogger = NewChatLogger(servState.networkName + "-" + pmState.nick)
+	t.chatlogger = NewChatLogger(servState, pmState.nick, func(nick string) string {
+		if nick == pmState.nick {
+			return pmState.UserHost()
+		}
+		return ""
+	})
 
 	mw.WindowBase.Synchronize(func() {
 		var err error
@@ -64,6 +64,12 @@ func (t *tabServer) Update(servState *serverState) {
 	for _, pmState := range servState.privmsgs {
 		pmState.tab.Update(servState, pmState)
 	}
+	if servState.transfers != nil {
+		servState.transfers.Update(servState)
+	}
+	if servState.xdcc != nil {
+		servState.xdcc.Update(servState)
+	}
 	if servState.channelList != nil {
 		servState.channelList.Update(servState)
 	}
@@ -73,7 +79,7 @@ func (t *tabServer) Update(servState *serverState) {
 func newServerTab(servConn *serverConnection, servState *serverState) *tabServer {
 	t := &tabServer{}
 	t.tabTitle = servState.networkName
-	t.chatlogger = NewChatLogger(servState.networkName)
+	t.chatlogger = NewChatLogger(servState, "", nil)
 
 	mw.WindowBase.Synchronize(func() {
 		var err error
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+)
+
+// tabTransfers shows the DCC file transfers for one server
+type tabTransfers struct {
+	tabCommon
+	mdl *transferListModel
+	tbl *walk.TableView
+}
+
+func (t *tabTransfers) Title() string {
+	return t.tabTitle
+}
+
+func (t *tabTransfers) Focus() {
+	mw.WindowBase.Synchronize(func() {
+		t.tabPage.SetTitle(t.Title())
+		SetStatusBarIcon(t.statusIcon)
+		SetStatusBarText(t.statusText)
+	})
+}
+
+func (t *tabTransfers) Update(servState *serverState) {
+	t.statusIcon = servState.tab.statusIcon
+	t.statusText = servState.tab.statusText
+	if t.HasFocus() {
+		SetStatusBarIcon(t.statusIcon)
+		SetStatusBarText(t.statusText)
+	}
+}
+
+// Refresh redraws the table with the current state of every transfer
+func (t *tabTransfers) Refresh() {
+	items := dccTransfers.ForServer(t.mdl.servState)
+	mw.WindowBase.Synchronize(func() {
+		t.mdl.items = items
+		t.mdl.PublishRowsReset()
+	})
+}
+
+// selected returns the highlighted transfer, if any
+func (t *tabTransfers) selected() *dccTransfer {
+	i := t.tbl.CurrentIndex()
+	if i < 0 || i >= len(t.mdl.items) {
+		return nil
+	}
+	return t.mdl.items[i]
+}
+
+// Transfers returns the transfers tab, opening it if it isn't already
+func (servState *serverState) Transfers(servConn *serverConnection) *tabTransfers {
+	if servState.transfers == nil {
+		ctx := tabMan.Create(&tabContext{servConn: servConn, servState: servState}, servState.tab.Index()+1)
+		servState.transfers = NewTransfersTab(servConn, servState)
+		ctx.tab = servState.transfers
+	}
+	return servState.transfers
+}
+
+func (servState *serverState) refreshTransfers() {
+	if servState.transfers != nil {
+		servState.transfers.Refresh()
+	}
+}
+
+func NewTransfersTab(servConn *serverConnection, servState *serverState) *tabTransfers {
+	t := &tabTransfers{}
+	t.mdl = &transferListModel{servState: servState, items: []*dccTransfer{}}
+	t.statusIcon = servState.tab.statusIcon
+	t.statusText = servState.tab.statusText
+
+	report := func(err error) {
+		if err != nil {
+			clientError(servState.tab, now(), err.Error())
+		}
+	}
+
+	mw.WindowBase.Synchronize(func() {
+		var err error
+		t.tabPage, err = walk.NewTabPage()
+		checkErr(err)
+		t.tabTitle = "transfers"
+		t.tabPage.SetTitle(t.tabTitle)
+		t.tabPage.SetLayout(walk.NewVBoxLayout())
+
+		builder := NewBuilder(t.tabPage)
+
+		w := float64(mw.ClientBounds().Width)
+
+		TableView{
+			AssignTo: &t.tbl,
+			Model:    t.mdl,
+			Columns: []TableViewColumn{
+				{Title: "#", Width: int(w * 0.05)},
+				{Title: "nick", Width: int(w * 0.12)},
+				{Title: "file", Width: int(w * 0.3)},
+				{Title: "progress", Width: int(w * 0.2)},
+				{Title: "speed", Width: int(w * 0.1)},
+				{Title: "status", Width: int(w * 0.2)},
+			},
+			OnItemActivated: func() {
+				if tr := t.selected(); tr != nil && tr.incoming {
+					report(tr.Accept())
+				}
+			},
+		}.Create(builder)
+
+		Composite{
+			Layout: HBox{MarginsZero: true},
+			Children: []Widget{
+				PushButton{
+					Text: "Accept",
+					OnClicked: func() {
+						if tr := t.selected(); tr != nil {
+							report(tr.Accept())
+						}
+					},
+				},
+				PushButton{
+					Text: "Decline",
+					OnClicked: func() {
+						if tr := t.selected(); tr != nil {
+							report(tr.Decline())
+						}
+					},
+				},
+				PushButton{
+					Text: "Cancel",
+					OnClicked: func() {
+						if tr := t.selected(); tr != nil {
+							report(tr.Cancel())
+						}
+					},
+				},
+				PushButton{
+					Text: "Clear Finished",
+					OnClicked: func() {
+						dccTransfers.RemoveFinished(servState)
+						t.Refresh()
+					},
+				},
+				HSpacer{},
+				PushButton{
+					Text: "Close Tab",
+					OnClicked: func() {
+						mw.WindowBase.Synchronize(func() {
+							t.Close()
+							tabMan.Delete(tabMan.Find(identityFinder(t)))
+							servState.transfers = nil
+							SetSystrayContextMenu()
+						})
+					},
+				},
+			},
+		}.Create(builder)
+
+		checkErr(tabWidget.Pages().Insert(servState.tab.Index()+1, t.tabPage))
+		tabWidget.SaveState()
+	})
+
+	t.Refresh()
+	return t
+}
+
+type transferListModel struct {
+	walk.TableModelBase
+	servState *serverState
+	items     []*dccTransfer
+}
+
+func (m *transferListModel) RowCount() int {
+	return len(m.items)
+}
+
+func (m *transferListModel) Value(row, col int) interface{} {
+	tr := m.items[row]
+
+	switch col {
+	case 0:
+		return strconv.Itoa(tr.id)
+	case 1:
+		if tr.incoming {
+			return "<- " + tr.nick
+		}
+		return "-> " + tr.nick
+	case 2:
+		return tr.filename
+	case 3:
+		return tr.Progress()
+	case 4:
+		if speed := tr.Speed(); speed > 0 {
+			return humanSize(speed) + "/s"
+		}
+		return ""
+	case 5:
+		return tr.Status()
+	}
+
+	log.Panicln("unexpected column:", col)
+	return nil
+}
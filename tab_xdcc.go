@@ -0,0 +1,184 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+)
+
+// tabXdcc is every pack we've seen bots on a server announce, searchable
+type tabXdcc struct {
+	tabCommon
+	xdcc   *xdccHelper
+	mdl    *xdccPackModel
+	tbl    *walk.TableView
+	search *walk.LineEdit
+}
+
+func (t *tabXdcc) Title() string {
+	return t.tabTitle
+}
+
+func (t *tabXdcc) Focus() {
+	mw.WindowBase.Synchronize(func() {
+		t.tabPage.SetTitle(t.Title())
+		SetStatusBarIcon(t.statusIcon)
+		SetStatusBarText(t.statusText)
+	})
+}
+
+func (t *tabXdcc) Update(servState *serverState) {
+	t.statusIcon = servState.tab.statusIcon
+	t.statusText = servState.tab.statusText
+	if t.HasFocus() {
+		SetStatusBarIcon(t.statusIcon)
+		SetStatusBarText(t.statusText)
+	}
+}
+
+// Refresh redraws the table with whatever matches the search box
+func (t *tabXdcc) Refresh() {
+	mw.WindowBase.Synchronize(func() {
+		t.mdl.items = t.xdcc.Search(strings.Fields(t.search.Text())...)
+		t.mdl.PublishRowsReset()
+	})
+}
+
+func (t *tabXdcc) selected() *xdccPack {
+	i := t.tbl.CurrentIndex()
+	if i < 0 || i >= len(t.mdl.items) {
+		return nil
+	}
+	return t.mdl.items[i]
+}
+
+// Xdcc returns the xdcc tab, opening it if it isn't already
+func (servState *serverState) Xdcc(servConn *serverConnection) *tabXdcc {
+	if servState.xdcc == nil {
+		ctx := tabMan.Create(&tabContext{servConn: servConn, servState: servState}, servState.tab.Index()+1)
+		servState.xdcc = NewXdccTab(servConn, servState)
+		ctx.tab = servState.xdcc
+	}
+	return servState.xdcc
+}
+
+func NewXdccTab(servConn *serverConnection, servState *serverState) *tabXdcc {
+	t := &tabXdcc{xdcc: servConn.xdcc}
+	t.mdl = &xdccPackModel{xdcc: servConn.xdcc, items: []*xdccPack{}}
+	t.statusIcon = servState.tab.statusIcon
+	t.statusText = servState.tab.statusText
+
+	request := func() {
+		if pack := t.selected(); pack != nil {
+			servConn.xdcc.Request(pack.bot, pack.number)
+		}
+	}
+
+	mw.WindowBase.Synchronize(func() {
+		var err error
+		t.tabPage, err = walk.NewTabPage()
+		checkErr(err)
+		t.tabTitle = "xdcc"
+		t.tabPage.SetTitle(t.tabTitle)
+		t.tabPage.SetLayout(walk.NewVBoxLayout())
+
+		builder := NewBuilder(t.tabPage)
+
+		w := float64(mw.ClientBounds().Width)
+
+		LineEdit{
+			AssignTo:      &t.search,
+			CueBanner:     "search",
+			OnTextChanged: t.Refresh,
+		}.Create(builder)
+
+		TableView{
+			AssignTo: &t.tbl,
+			Model:    t.mdl,
+			Columns: []TableViewColumn{
+				{Title: "bot", Width: int(w * 0.12)},
+				{Title: "#", Width: int(w * 0.06)},
+				{Title: "gets", Width: int(w * 0.06)},
+				{Title: "size", Width: int(w * 0.08)},
+				{Title: "file", Width: int(w * 0.5)},
+				{Title: "status", Width: int(w * 0.12)},
+			},
+			OnItemActivated: request,
+		}.Create(builder)
+
+		Composite{
+			Layout: HBox{MarginsZero: true},
+			Children: []Widget{
+				PushButton{
+					Text:      "Request",
+					OnClicked: request,
+				},
+				PushButton{
+					Text: "Refresh List",
+					OnClicked: func() {
+						if pack := t.selected(); pack != nil {
+							servConn.conn.Privmsg(pack.bot, "XDCC LIST")
+						}
+					},
+				},
+				PushButton{
+					Text:      "Clear",
+					OnClicked: servConn.xdcc.Clear,
+				},
+				HSpacer{},
+				PushButton{
+					Text: "Close Tab",
+					OnClicked: func() {
+						mw.WindowBase.Synchronize(func() {
+							t.Close()
+							tabMan.Delete(tabMan.Find(identityFinder(t)))
+							servState.xdcc = nil
+							SetSystrayContextMenu()
+						})
+					},
+				},
+			},
+		}.Create(builder)
+
+		checkErr(tabWidget.Pages().Insert(servState.tab.Index()+1, t.tabPage))
+		tabWidget.SaveState()
+	})
+
+	t.Refresh()
+	return t
+}
+
+type xdccPackModel struct {
+	walk.TableModelBase
+	xdcc  *xdccHelper
+	items []*xdccPack
+}
+
+func (m *xdccPackModel) RowCount() int {
+	return len(m.items)
+}
+
+func (m *xdccPackModel) Value(row, col int) interface{} {
+	pack := m.items[row]
+
+	switch col {
+	case 0:
+		return pack.bot
+	case 1:
+		return strconv.Itoa(pack.number)
+	case 2:
+		return strconv.Itoa(pack.gets)
+	case 3:
+		return pack.size
+	case 4:
+		return pack.name
+	case 5:
+		return m.xdcc.RequestState(pack.bot, pack.number)
+	}
+
+	log.Panicln("unexpected column:", col)
+	return nil
+}
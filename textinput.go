@@ -74,6 +74,9 @@ func NewTextInput(t tabWithTextBuffer) *MyLineEdit {
 	case *tabPrivmsg:
 		tabPage = t.(*tabPrivmsg).tabPage
 		sendFn = t.(*tabPrivmsg).Send
+	case *tabDccChat:
+		tabPage = t.(*tabDccChat).tabPage
+		sendFn = t.(*tabDccChat).Send
 	default:
 		log.Panicf("unsupported type %T", t)
 	}
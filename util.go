@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -55,3 +58,123 @@ func isService(nick string) bool {
 	}
 	return false
 }
+
+// matchMask matches s against an irc style wildcard mask, where * matches any
+// number of characters and ? matches exactly one, e.g.
+//
+//	matchMask("*!*@*.example.org", "nick!user@host.example.org") == true
+//
+// comparison is case-insensitive.
+func matchMask(mask, s string) bool {
+	m, str := []rune(strings.ToLower(mask)), []rune(strings.ToLower(s))
+	mi, si := 0, 0
+	star, mark := -1, 0
+	for si < len(str) {
+		switch {
+		case mi < len(m) && (m[mi] == '?' || m[mi] == str[si]):
+			mi++
+			si++
+		case mi < len(m) && m[mi] == '*':
+			star, mark = mi, si
+			mi++
+		case star != -1:
+			mi = star + 1
+			mark++
+			si = mark
+		default:
+			return false
+		}
+	}
+	for mi < len(m) && m[mi] == '*' {
+		mi++
+	}
+	return mi == len(m)
+}
+
+var durationRegex = regexp.MustCompile(`^(\d+[wdhms])+$`)
+var durationPartRegex = regexp.MustCompile(`(\d+)([wdhms])`)
+
+// parseDuration is time.ParseDuration but with days and weeks because
+// nobody types 720h, e.g. "30d", "1w2d", "10m"
+func parseDuration(str string) (time.Duration, error) {
+	if !durationRegex.MatchString(str) {
+		return time.ParseDuration(str)
+	}
+	var d time.Duration
+	for _, m := range durationPartRegex.FindAllStringSubmatch(str, -1) {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "w":
+			d += time.Duration(n) * time.Hour * 24 * 7
+		case "d":
+			d += time.Duration(n) * time.Hour * 24
+		case "h":
+			d += time.Duration(n) * time.Hour
+		case "m":
+			d += time.Duration(n) * time.Minute
+		case "s":
+			d += time.Duration(n) * time.Second
+		}
+	}
+	return d, nil
+}
+
+// humanDuration formats d to the two most significant units, e.g. "31d 4h",
+// "5m 2s"
+func humanDuration(d time.Duration) string {
+	if d < time.Second {
+		return "0s"
+	}
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", time.Hour * 24},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	parts := []string{}
+	for _, u := range units {
+		if d >= u.size {
+			parts = append(parts, strconv.Itoa(int(d/u.size))+u.suffix)
+			d %= u.size
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// humanSize formats a number of bytes e.g. "512 B", "1.5 MB"
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(n)/float64(div), 'f', 1, 64) + " " + string("KMGTP"[exp]) + "B"
+}
+
+// parseSize is the opposite of humanSize, e.g. "512", "100K", "1.5 MB"
+func parseSize(str string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(str))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := 1.0
+	if s != "" {
+		if exp := strings.IndexByte("KMGT", s[len(s)-1]); exp != -1 {
+			mult = math.Pow(1024, float64(exp+1))
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", str)
+	}
+	return int64(n * mult), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchMask(t *testing.T) {
+	for _, test := range []struct {
+		mask, s string
+		match   bool
+	}{
+		{"*", "anything", true},
+		{"*", "", true},
+		{"", "", true},
+		{"", "a", false},
+		{"*!*@*.example.org", "nick!user@host.example.org", true},
+		{"*!*@*.example.org", "nick!user@example.org", false},
+		{"nick!*@*", "NICK!user@host", true},
+		{"n?ck!*@*", "neck!user@host", true},
+		{"n?ck!*@*", "nck!user@host", false},
+		{"*!*@127.0.0.*", "a!b@127.0.0.1", true},
+		{"*a*b*c", "xaybzc", true},
+		{"*a*b*c", "xaybzcd", false},
+		{"*!*@*", "*!*@*", true},
+	} {
+		if m := matchMask(test.mask, test.s); m != test.match {
+			t.Errorf("matchMask(%q, %q): expected %v got %v", test.mask, test.s, test.match, m)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, test := range []struct {
+		str string
+		d   time.Duration
+		err bool
+	}{
+		{"30d", time.Hour * 24 * 30, false},
+		{"1w2d", time.Hour * 24 * 9, false},
+		{"10m", time.Minute * 10, false},
+		{"1h30m", time.Minute * 90, false},
+		{"90s", time.Second * 90, false},
+		{"1.5h", time.Minute * 90, false},
+		{"forever", 0, true},
+	} {
+		d, err := parseDuration(test.str)
+		if d != test.d || (err != nil) != test.err {
+			t.Errorf("parseDuration(%q): expected %v (err: %v) got %v (err: %v)", test.str, test.d, test.err, d, err)
+		}
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	for _, test := range []struct {
+		d   time.Duration
+		str string
+	}{
+		{0, "0s"},
+		{time.Second * 62, "1m 2s"},
+		{time.Hour*24*31 + time.Hour*4 + time.Minute, "31d 4h"},
+		{time.Hour * 3, "3h"},
+	} {
+		if str := humanDuration(test.d); str != test.str {
+			t.Errorf("humanDuration(%v): expected %q got %q", test.d, test.str, str)
+		}
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	for _, test := range []struct {
+		n   int64
+		str string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{1024 * 1024 * 700, "700.0 MB"},
+		{1024 * 1024 * 1024 * 3, "3.0 GB"},
+	} {
+		if str := humanSize(test.n); str != test.str {
+			t.Errorf("humanSize(%d): expected %q got %q", test.n, test.str, str)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, test := range []struct {
+		str string
+		n   int64
+		err bool
+	}{
+		{"512", 512, false},
+		{"100K", 100 * 1024, false},
+		{"100kb", 100 * 1024, false},
+		{"1.5 MB", 1536 * 1024, false},
+		{"2MiB", 2 * 1024 * 1024, false},
+		{"1G", 1 << 30, false},
+		{"", 0, true},
+		{"fast", 0, true},
+		{"-1K", 0, true},
+	} {
+		n, err := parseSize(test.str)
+		if n != test.n || (err != nil) != test.err {
+			t.Errorf("parseSize(%q): expected %d (err: %v) got %d (err: %v)", test.str, test.n, test.err, n, err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goirc "github.com/fluffle/goirc/client"
+)
+
+// WHOIS replies trickle in one numeric at a time and end with 318
+// (ENDOFWHOIS), so we collect them per target nick and print one block at
+// the end instead of a dozen S(311): lines.
+type whoisResult struct {
+	nick, user, host, realname string
+	server, serverInfo         string
+	account                    string
+	registered                 bool // 307, says nothing about which account
+	channels                   []string
+	idle                       time.Duration
+	signon                     time.Time
+	operator                   string
+	secure                     string
+	certfp                     string
+	away                       string
+	actualIP                   string   // from 338/378, only for opers and yourself
+	extra                      []string // anything else the server felt like telling us
+}
+
+type whoisCollector struct {
+	results map[string]*whoisResult
+	mu      *sync.Mutex
+}
+
+func newWhoisCollector() *whoisCollector {
+	return &whoisCollector{
+		results: map[string]*whoisResult{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+// Get returns the pending result for nick, creating it if create is true
+func (wc *whoisCollector) Get(nick string, create bool) *whoisResult {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	key := strings.ToLower(nick)
+	res, ok := wc.results[key]
+	if !ok && create {
+		res = &whoisResult{nick: nick}
+		wc.results[key] = res
+	}
+	return res
+}
+
+func (wc *whoisCollector) Done(nick string) *whoisResult {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	key := strings.ToLower(nick)
+	res := wc.results[key]
+	delete(wc.results, key)
+	return res
+}
+
+func (res *whoisResult) String() string {
+	lines := []string{bold(res.nick)}
+	if res.user != "" || res.host != "" {
+		lines[0] += " (" + res.user + "@" + res.host + ")"
+	}
+	field := func(name, value string) {
+		if value != "" {
+			lines = append(lines, fmt.Sprintf("    %-9s %s", name+":", value))
+		}
+	}
+	field("realname", res.realname)
+	if res.server != "" {
+		server := res.server
+		if res.serverInfo != "" {
+			server += " (" + res.serverInfo + ")"
+		}
+		field("server", server)
+	}
+	if res.account != "" {
+		field("account", "logged in as "+res.account)
+	} else if res.registered {
+		field("account", "nick is registered")
+	}
+	if len(res.channels) > 0 {
+		field("channels", strings.Join(res.channels, " "))
+	}
+	if res.idle > 0 || !res.signon.IsZero() {
+		idle := humanDuration(res.idle)
+		if !res.signon.IsZero() {
+			idle += ", signed on " + res.signon.Format("Mon Jan 2 2006 15:04:05")
+		}
+		field("idle", idle)
+	}
+	field("tls", res.secure)
+	field("certfp", res.certfp)
+	field("operator", res.operator)
+	field("away", res.away)
+	for _, x := range res.extra {
+		field("info", x)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func whoisHandler(servConn *serverConnection, servState *serverState) goirc.HandlerFunc {
+	return func(c *goirc.Conn, l *goirc.Line) {
+		// l.Args[0] is our nick, l.Args[1] is the target for all of these
+		if len(l.Args) < 2 {
+			return
+		}
+		nick := l.Args[1]
+
+		if l.Cmd == "318" {
+			res := servConn.whois.Done(nick)
+			if res == nil {
+				// e.g. 401 no such nick, which was already printed
+				return
+			}
+			if res.nick == servState.user.nick {
+				servConn.learnHost(res.host)
+				servConn.learnHost(res.actualIP)
+			}
+			for _, chanState := range servState.channels {
+				if chanState.nickList.Has(res.nick) {
+					if res.host != "" {
+						chanState.nickList.SetUserHost(res.nick, res.user, res.host)
+					}
+					if res.account != "" {
+						chanState.nickList.SetAccount(res.nick, res.account)
+					}
+				}
+			}
+			dest := []tabWithTextBuffer{servState.CurrentTab()}
+			if dest[0].Index() != servState.tab.Index() {
+				dest = append(dest, servState.tab)
+			}
+			Println(SERVER_MESSAGE, dest, "WHOIS", res.String())
+			return
+		}
+
+		servConn.whois.Get(nick, true).add(l)
+	}
+}
+
+// add is one WHOIS numeric for res, l.Args[1] is res.nick
+func (res *whoisResult) add(l *goirc.Line) {
+	text := l.Args[len(l.Args)-1]
+	switch l.Cmd {
+	case "311": // WHOISUSER <nick> <user> <host> * :<realname>
+		if len(l.Args) > 5 {
+			res.nick, res.user, res.host, res.realname = l.Args[1], l.Args[2], l.Args[3], l.Args[5]
+		}
+	case "312": // WHOISSERVER <nick> <server> :<info>
+		if len(l.Args) > 3 {
+			res.server, res.serverInfo = l.Args[2], l.Args[3]
+		}
+	case "313": // WHOISOPERATOR
+		res.operator = text
+	case "317": // WHOISIDLE <nick> <idle> [<signon>] :seconds idle, signon time
+		if len(l.Args) > 2 {
+			if n, err := strconv.Atoi(l.Args[2]); err == nil {
+				res.idle = time.Duration(n) * time.Second
+			}
+		}
+		if len(l.Args) > 4 {
+			if n, err := strconv.ParseInt(l.Args[3], 10, 64); err == nil {
+				res.signon = time.Unix(n, 0)
+			}
+		}
+	case "319": // WHOISCHANNELS :{[prefix]channel}
+		for _, ch := range strings.Fields(text) {
+			res.channels = append(res.channels, ch)
+		}
+		sort.Slice(res.channels, func(i, j int) bool {
+			return strings.TrimLeft(res.channels[i], "~&@%+") < strings.TrimLeft(res.channels[j], "~&@%+")
+		})
+	case "330": // WHOISACCOUNT <nick> <account> :is logged in as
+		if len(l.Args) > 2 {
+			res.account = l.Args[2]
+		}
+	case "671": // WHOISSECURE
+		res.secure = text
+	case "276": // WHOISCERTFP
+		res.certfp = text
+	case "301": // AWAY
+		res.away = text
+	case "307": // WHOISREGNICK
+		res.registered = true
+	case "338", "378": // WHOISACTUALLY, WHOISHOST: formats vary a lot but there's an ip in there somewhere
+		for _, f := range strings.Fields(strings.Join(l.Args[2:], " ")) {
+			if i := strings.LastIndex(f, "@"); i != -1 {
+				f = f[i+1:]
+			}
+			if net.ParseIP(f) != nil {
+				res.actualIP = f
+			}
+		}
+		res.extra = append(res.extra, strings.Join(l.Args[2:], " "))
+	default:
+		res.extra = append(res.extra, strings.Join(l.Args[2:], " "))
+	}
+}
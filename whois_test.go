@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	goirc "github.com/fluffle/goirc/client"
+)
+
+func TestWhoisCollector(t *testing.T) {
+	for _, test := range []struct {
+		lines    []string
+		expected []string
+	}{
+		{
+			[]string{
+				":irc.example.com 311 me tso ~tso example.com * :real name",
+				":irc.example.com 319 me tso :@#chopsuey #b",
+				":irc.example.com 312 me tso irc.example.com :example server",
+				":irc.example.com 330 me tso tsoaccount :is logged in as",
+				":irc.example.com 307 me tso :has identified for this nick",
+			},
+			[]string{
+				"\x02tso\x02 (~tso@example.com)",
+				"    realname: real name",
+				"    server:   irc.example.com (example server)",
+				"    account:  logged in as tsoaccount",
+				"    channels: #b @#chopsuey",
+			},
+		},
+		{
+			// 307 on its own doesn't tell us the account name
+			[]string{
+				":irc.example.com 311 me TSO ~tso example.com * :real name",
+				":irc.example.com 307 me TSO :is a registered nick",
+			},
+			[]string{
+				"\x02TSO\x02 (~tso@example.com)",
+				"    realname: real name",
+				"    account:  nick is registered",
+			},
+		},
+	} {
+		wc := newWhoisCollector()
+		for _, line := range test.lines {
+			l := goirc.ParseLine(line)
+			wc.Get(l.Args[1], true).add(l)
+		}
+		// 318 is for whatever case the nick was asked for in
+		res := wc.Done("tso")
+		if res == nil {
+			t.Errorf("%q: no result", test.lines)
+			continue
+		}
+		if got := res.String(); got != strings.Join(test.expected, "\n") {
+			t.Errorf("expected\n%s\ngot\n%s", strings.Join(test.expected, "\n"), got)
+		}
+		if wc.Done("tso") != nil {
+			t.Errorf("result still there after Done")
+		}
+	}
+}
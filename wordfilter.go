@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// word filters replace text in messages, e.g. "fuck" => "****" or 4chan
+// style "fam" => "desu". they're "wordfilters" in config.json and can be
+// edited with /filter.
+
+const (
+	FILTER_IN = 1 << iota
+	FILTER_OUT
+	FILTER_BOTH = FILTER_IN | FILTER_OUT
+)
+
+type wordFilter struct {
+	Pattern   string   `json:"pattern"`
+	Replace   string   `json:"replace"`
+	Regex     bool     `json:"regex,omitempty"`     // otherwise a word or phrase, any case
+	Direction string   `json:"direction,omitempty"` // "in", "out" or "both" (the default)
+	Channels  []string `json:"channels,omitempty"`  // channels or nicks, empty means everywhere
+}
+
+func (f *wordFilter) direction() int {
+	switch strings.ToLower(f.Direction) {
+	case "in":
+		return FILTER_IN
+	case "out":
+		return FILTER_OUT
+	}
+	return FILTER_BOTH
+}
+
+func (f *wordFilter) appliesTo(target string) bool {
+	if len(f.Channels) == 0 {
+		return true
+	}
+	for _, c := range f.Channels {
+		if strings.EqualFold(c, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *wordFilter) String() string {
+	line := bold(f.Pattern) + " => " + f.Replace
+	if f.Regex {
+		line += " (regex)"
+	}
+	switch f.direction() {
+	case FILTER_IN:
+		line += " incoming"
+	case FILTER_OUT:
+		line += " outgoing"
+	}
+	if len(f.Channels) > 0 {
+		line += " on " + strings.Join(f.Channels, ", ")
+	}
+	return line
+}
+
+// compile turns a filter into a regexp and a template for Expand. plain
+// words only match on their own so "fam" doesn't turn "family" into
+// "desuily".
+func (f *wordFilter) compile() (*regexp.Regexp, string, error) {
+	if f.Regex {
+		re, err := regexp.Compile(f.Pattern)
+		return re, f.Replace, err
+	}
+	if f.Pattern == "" {
+		return nil, "", fmt.Errorf("empty pattern")
+	}
+	expr := regexp.QuoteMeta(f.Pattern)
+	if isWordByte(f.Pattern[0]) {
+		expr = `\b` + expr
+	}
+	if isWordByte(f.Pattern[len(f.Pattern)-1]) {
+		expr += `\b`
+	}
+	re, err := regexp.Compile("(?i)" + expr)
+	return re, strings.Replace(f.Replace, "$", "$$", -1), err
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// fmtCodeLen is how many bytes of formatting code start at str[i], e.g.
+// bold is 1 and a color can be up to 6 (^C12,34)
+func fmtCodeLen(str string, i int) int {
+	if strings.IndexByte(fmtCharsString, str[i]) == -1 {
+		return 0
+	}
+	if str[i] != '\x03' {
+		return 1
+	}
+	n := 1
+	digits := func() int {
+		d := 0
+		for d < 2 && i+n+d < len(str) && str[i+n+d] >= '0' && str[i+n+d] <= '9' {
+			d++
+		}
+		return d
+	}
+	if d := digits(); d > 0 {
+		n += d
+		if i+n+1 < len(str) && str[i+n] == ',' && str[i+n+1] >= '0' && str[i+n+1] <= '9' {
+			n++
+			n += digits()
+		}
+	}
+	return n
+}
+
+// replaceVisible replaces matches of re in the text you'd actually see,
+// ignoring formatting codes. codes outside a match stay where they are and
+// codes inside it end up right after the replacement so colors and bold
+// still turn on and off in the same places.
+func replaceVisible(str string, re *regexp.Regexp, template string) string {
+	visible := []byte{}
+	pos := []int{} // where each byte of visible is in str
+	for i := 0; i < len(str); {
+		if n := fmtCodeLen(str, i); n > 0 {
+			i += n
+			continue
+		}
+		visible = append(visible, str[i])
+		pos = append(pos, i)
+		i++
+	}
+
+	matches := re.FindAllSubmatchIndex(visible, -1)
+	if len(matches) == 0 {
+		return str
+	}
+	out := []byte{}
+	last := 0
+	for _, m := range matches {
+		if m[1] == m[0] {
+			continue
+		}
+		start, end := pos[m[0]], pos[m[1]-1]+1
+		out = append(out, str[last:start]...)
+		out = re.Expand(out, []byte(template), visible, m)
+		for i := start; i < end; {
+			if n := fmtCodeLen(str, i); n > 0 {
+				out = append(out, str[i:i+n]...)
+				i += n
+				continue
+			}
+			i++
+		}
+		last = end
+	}
+	out = append(out, str[last:]...)
+	return string(out)
+}
+
+type compiledFilter struct {
+	*wordFilter
+	re       *regexp.Regexp
+	template string
+}
+
+// wordFilterList caches the compiled filters from config.json
+type wordFilterList struct {
+	compiled []*compiledFilter
+	mu       *sync.Mutex
+}
+
+var wordFilters = &wordFilterList{mu: &sync.Mutex{}}
+
+// Update changes the filters in config.json with fn and saves them if fn
+// returns true
+func (wl *wordFilterList) Update(fn func(filters *[]*wordFilter) bool) error {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	if !fn(&clientCfg.WordFilters) {
+		return nil
+	}
+	wl.compiled = nil
+	return writeClientConfig()
+}
+
+func (wl *wordFilterList) filters() []*compiledFilter {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	if wl.compiled == nil {
+		wl.compiled = []*compiledFilter{}
+		for _, f := range clientCfg.WordFilters {
+			re, template, err := f.compile()
+			if err != nil {
+				log.Printf("invalid word filter %q: %v", f.Pattern, err)
+				continue
+			}
+			wl.compiled = append(wl.compiled, &compiledFilter{f, re, template})
+		}
+	}
+	return wl.compiled
+}
+
+// Apply runs every filter for direction (FILTER_IN or FILTER_OUT) and
+// target (the channel, or nick for private messages) over text
+func (wl *wordFilterList) Apply(direction int, target, text string) string {
+	for _, f := range wl.filters() {
+		if f.direction()&direction != 0 && f.appliesTo(target) {
+			text = replaceVisible(text, f.re, f.template)
+		}
+	}
+	return text
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestWordFilter(t *testing.T) {
+	for _, test := range []struct {
+		filter   *wordFilter
+		in, want string
+	}{
+		{&wordFilter{Pattern: "fam", Replace: "desu"}, "hey FAM, what's up fam", "hey desu, what's up desu"},
+		{&wordFilter{Pattern: "fam", Replace: "desu"}, "my family", "my family"},
+		{&wordFilter{Pattern: "the cloud", Replace: "my butt"}, "it's in the cloud", "it's in my butt"},
+		{&wordFilter{Pattern: "c++", Replace: "$0"}, "i like c++", "i like $0"},
+		{&wordFilter{Pattern: `(\w+)coin`, Replace: "${1}scam", Regex: true}, "buy dogecoin", "buy dogescam"},
+		// formatting around the word stays put
+		{&wordFilter{Pattern: "fam", Replace: "desu"}, "\x02fam\x02 hi", "\x02desu\x02 hi"},
+		{&wordFilter{Pattern: "fam", Replace: "desu"}, "\x0304,01fam\x03!", "\x0304,01desu\x03!"},
+		// and formatting inside it ends up after the replacement
+		{&wordFilter{Pattern: "the cloud", Replace: "my butt"}, "the \x02cloud\x02 ok", "my butt\x02\x02 ok"},
+		{&wordFilter{Pattern: "fam", Replace: "desu"}, "f\x0312am", "desu\x0312"},
+	} {
+		re, template, err := test.filter.compile()
+		if err != nil {
+			t.Errorf("compile(%q): %v", test.filter.Pattern, err)
+			continue
+		}
+		if got := replaceVisible(test.in, re, template); got != test.want {
+			t.Errorf("%q => %q on %q: expected %q got %q", test.filter.Pattern, test.filter.Replace, test.in, test.want, got)
+		}
+	}
+}
+
+func TestWordFilterScope(t *testing.T) {
+	f := &wordFilter{Direction: "in", Channels: []string{"#chopsuey"}}
+	if f.direction() != FILTER_IN {
+		t.Errorf("expected FILTER_IN got %d", f.direction())
+	}
+	if !f.appliesTo("#ChopSuey") || f.appliesTo("#other") {
+		t.Errorf("expected only #chopsuey")
+	}
+	if f := (&wordFilter{}); f.direction() != FILTER_BOTH || !f.appliesTo("anyone") {
+		t.Errorf("expected both directions everywhere")
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// XDCC bots (iroffer and friends) announce what they have in channels and
+// answer "XDCC LIST" with notices that look like
+//
+//	#1   12x [1.2G] Some.File.Name.mkv
+//
+// and send you a file with DCC SEND when you /msg them "XDCC SEND #1". if
+// their slots are full they put you in a queue and tell you your position.
+
+var xdccPackRegex = regexp.MustCompile(`^\s*#(\d+)\s+(\d+)x\s+\[\s*([^\]]*?)\s*\]\s+(.+?)\s*$`)
+var xdccPositionRegex = regexp.MustCompile(`(?i)position\s+#?(\d+)`)
+
+const (
+	xdccMaxRetries    = 5
+	xdccRetryDelay    = time.Minute
+	xdccOfferTimeout  = time.Minute * 2
+	xdccRefreshPeriod = time.Millisecond * 500
+)
+
+type xdccPack struct {
+	bot    string
+	number int
+	gets   int
+	size   string
+	name   string
+}
+
+// parseXdccPack parses a packlist line, returns nil if it isn't one
+func parseXdccPack(bot, line string) *xdccPack {
+	m := xdccPackRegex.FindStringSubmatch(stripFmtChars(line))
+	if m == nil {
+		return nil
+	}
+	number, _ := strconv.Atoi(m[1])
+	gets, _ := strconv.Atoi(m[2])
+	return &xdccPack{bot: bot, number: number, gets: gets, size: m[3], name: m[4]}
+}
+
+const (
+	XDCC_WAITING = iota // in our queue, not asked yet
+	XDCC_REQUESTED
+	XDCC_QUEUED // in the bot's queue
+	XDCC_RETRY
+	XDCC_TRANSFERRING
+	XDCC_DONE
+	XDCC_FAILED
+	XDCC_CANCELLED
+)
+
+func xdccStateString(state int) string {
+	switch state {
+	case XDCC_WAITING:
+		return "waiting"
+	case XDCC_REQUESTED:
+		return "requested"
+	case XDCC_QUEUED:
+		return "queued"
+	case XDCC_RETRY:
+		return "retrying"
+	case XDCC_TRANSFERRING:
+		return "transferring"
+	case XDCC_DONE:
+		return "done"
+	case XDCC_FAILED:
+		return "failed"
+	case XDCC_CANCELLED:
+		return "cancelled"
+	}
+	return "?"
+}
+
+type xdccRequest struct {
+	bot      string
+	number   int
+	name     string
+	state    int
+	position int
+	attempts int
+	reason   string
+	transfer *dccTransfer
+	timer    *time.Timer
+}
+
+func (req *xdccRequest) String() string {
+	line := fmt.Sprintf("%s #%d", req.bot, req.number)
+	if req.name != "" {
+		line += " " + bold(req.name)
+	}
+	line += "  " + xdccStateString(req.state)
+	if req.state == XDCC_QUEUED && req.position > 0 {
+		line += fmt.Sprintf(" (position %d)", req.position)
+	}
+	if req.transfer != nil {
+		line += fmt.Sprintf(" (DCC #%d)", req.transfer.id)
+	}
+	if req.reason != "" {
+		line += ": " + req.reason
+	}
+	return line
+}
+
+// xdccHelper remembers every pack we've seen on a server and the packs we
+// asked for. we ask each bot for one pack at a time since most of them
+// won't give you more than that anyway.
+type xdccHelper struct {
+	servConn  *serverConnection
+	servState *serverState
+
+	packs      map[string]map[int]*xdccPack // by lowercase bot nick
+	requests   []*xdccRequest
+	refreshing bool
+	mu         *sync.Mutex
+}
+
+func newXdccHelper(servConn *serverConnection, servState *serverState) *xdccHelper {
+	return &xdccHelper{
+		servConn:  servConn,
+		servState: servState,
+		packs:     map[string]map[int]*xdccPack{},
+		requests:  []*xdccRequest{},
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (x *xdccHelper) notify(msg string) {
+	dest := []tabWithTextBuffer{x.servState.CurrentTab()}
+	if dest[0].Index() != x.servState.tab.Index() {
+		dest = append(dest, x.servState.tab)
+	}
+	Println(CLIENT_MESSAGE, dest, now(), "XDCC: "+msg)
+}
+
+// refresh redraws the xdcc tab, at most every xdccRefreshPeriod since
+// packlists come in hundreds of lines at a time
+func (x *xdccHelper) refresh() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.refreshing {
+		return
+	}
+	x.refreshing = true
+	time.AfterFunc(xdccRefreshPeriod, func() {
+		x.mu.Lock()
+		x.refreshing = false
+		x.mu.Unlock()
+		if t := x.servState.xdcc; t != nil {
+			t.Refresh()
+		}
+	})
+}
+
+// Line is called with every privmsg and notice, it picks out packlist
+// entries and replies to our requests
+func (x *xdccHelper) Line(nick, text string) {
+	if pack := parseXdccPack(nick, text); pack != nil {
+		x.mu.Lock()
+		key := strings.ToLower(nick)
+		if x.packs[key] == nil {
+			x.packs[key] = map[int]*xdccPack{}
+		}
+		x.packs[key][pack.number] = pack
+		x.mu.Unlock()
+		x.refresh()
+		return
+	}
+
+	x.mu.Lock()
+	req := x.active(nick)
+	state := XDCC_WAITING
+	if req != nil {
+		state = req.state
+	}
+	x.mu.Unlock()
+	if state != XDCC_REQUESTED && state != XDCC_QUEUED {
+		return
+	}
+	x.reply(req, stripFmtChars(text))
+}
+
+// reply deals with what a bot says after we ask for a pack
+func (x *xdccHelper) reply(req *xdccRequest, text string) {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.Contains(lower, "invalid pack"):
+		x.finish(req, XDCC_FAILED, "no such pack")
+	case strings.Contains(lower, "queue") && xdccPositionRegex.MatchString(text):
+		position, _ := strconv.Atoi(xdccPositionRegex.FindStringSubmatch(text)[1])
+		x.mu.Lock()
+		req.state = XDCC_QUEUED
+		req.position = position
+		if req.timer != nil {
+			req.timer.Stop()
+		}
+		x.mu.Unlock()
+		x.notify(fmt.Sprintf("%s queued pack #%d, position %d", req.bot, req.number, position))
+		x.refresh()
+	case strings.Contains(lower, "denied"),
+		strings.Contains(lower, "try again"),
+		strings.Contains(lower, "slots full"),
+		strings.Contains(lower, "only have"),
+		strings.Contains(lower, "queue is full"):
+		x.retry(req, text)
+	}
+}
+
+// active returns the request we're currently dealing with from bot
+func (x *xdccHelper) active(bot string) *xdccRequest {
+	for _, req := range x.requests {
+		if strings.EqualFold(req.bot, bot) && req.state > XDCC_WAITING && req.state < XDCC_DONE {
+			return req
+		}
+	}
+	return nil
+}
+
+// Request adds a pack to the queue, we ask for it when the bot is free
+func (x *xdccHelper) Request(bot string, number int) *xdccRequest {
+	x.mu.Lock()
+	req := &xdccRequest{bot: bot, number: number, state: XDCC_WAITING}
+	if pack, ok := x.packs[strings.ToLower(bot)][number]; ok {
+		req.name = pack.name
+	}
+	x.requests = append(x.requests, req)
+	x.mu.Unlock()
+	x.next(bot)
+	return req
+}
+
+// next asks bot for the next pack in our queue if we aren't waiting on it
+// for something else already
+func (x *xdccHelper) next(bot string) {
+	x.mu.Lock()
+	if x.active(bot) != nil {
+		x.mu.Unlock()
+		return
+	}
+	var req *xdccRequest
+	for _, r := range x.requests {
+		if strings.EqualFold(r.bot, bot) && r.state == XDCC_WAITING {
+			req = r
+			break
+		}
+	}
+	x.mu.Unlock()
+	if req != nil {
+		x.send(req)
+	}
+}
+
+func (x *xdccHelper) send(req *xdccRequest) {
+	x.mu.Lock()
+	req.state = XDCC_REQUESTED
+	req.attempts++
+	req.reason = ""
+	// some bots just ignore you
+	req.timer = time.AfterFunc(xdccOfferTimeout, func() {
+		x.mu.Lock()
+		waiting := req.state == XDCC_REQUESTED
+		x.mu.Unlock()
+		if waiting {
+			x.retry(req, "no answer")
+		}
+	})
+	x.mu.Unlock()
+	x.servConn.conn.Privmsg(req.bot, fmt.Sprintf("XDCC SEND #%d", req.number))
+	x.notify(fmt.Sprintf("asked %s for pack #%d", req.bot, req.number))
+	x.refresh()
+}
+
+func (x *xdccHelper) retry(req *xdccRequest, reason string) {
+	x.mu.Lock()
+	if req.timer != nil {
+		req.timer.Stop()
+	}
+	if req.attempts >= xdccMaxRetries {
+		x.mu.Unlock()
+		x.finish(req, XDCC_FAILED, reason)
+		return
+	}
+	req.state = XDCC_RETRY
+	req.reason = reason
+	attempts := req.attempts
+	req.timer = time.AfterFunc(xdccRetryDelay, func() {
+		x.mu.Lock()
+		retry := req.state == XDCC_RETRY
+		x.mu.Unlock()
+		if retry {
+			x.send(req)
+		}
+	})
+	x.mu.Unlock()
+	x.notify(fmt.Sprintf("%s: %s, trying pack #%d again in %s (%d/%d)",
+		req.bot, reason, req.number, humanDuration(xdccRetryDelay), attempts, xdccMaxRetries))
+	x.refresh()
+}
+
+func (x *xdccHelper) finish(req *xdccRequest, state int, reason string) {
+	x.mu.Lock()
+	if req.timer != nil {
+		req.timer.Stop()
+	}
+	req.state = state
+	req.reason = reason
+	x.mu.Unlock()
+	if state == XDCC_FAILED {
+		x.notify(color(fmt.Sprintf("couldn't get pack #%d from %s: %s", req.number, req.bot, reason), Red))
+	}
+	x.refresh()
+	x.next(req.bot)
+}
+
+// Offered is called with every incoming DCC SEND, if it's from a bot we
+// asked for something it's accepted without asking
+func (x *xdccHelper) Offered(tr *dccTransfer) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	req := x.active(tr.nick)
+	if req == nil || req.state == XDCC_TRANSFERRING {
+		return false
+	}
+	if req.timer != nil {
+		req.timer.Stop()
+	}
+	req.state = XDCC_TRANSFERRING
+	req.transfer = tr
+	if req.name == "" {
+		req.name = tr.offered
+	}
+	return true
+}
+
+// Finished is called when any incoming transfer ends
+func (x *xdccHelper) Finished(tr *dccTransfer) {
+	x.mu.Lock()
+	var req *xdccRequest
+	for _, r := range x.requests {
+		if r.transfer == tr && r.state == XDCC_TRANSFERRING {
+			req = r
+		}
+	}
+	x.mu.Unlock()
+	if req == nil {
+		return
+	}
+	state, _, err := tr.State()
+	switch state {
+	case DCC_DONE:
+		x.finish(req, XDCC_DONE, "")
+	case DCC_FAILED:
+		// if we got some of it the retry resumes where it left off
+		reason := "transfer failed"
+		if err != nil {
+			reason = err.Error()
+		}
+		x.mu.Lock()
+		req.transfer = nil
+		x.mu.Unlock()
+		x.retry(req, reason)
+	default:
+		reason := "transfer " + dccStateString(state)
+		if err != nil {
+			reason = err.Error()
+		}
+		x.finish(req, XDCC_CANCELLED, reason)
+	}
+}
+
+// Cancel forgets about a request and tells the bot if it had us queued
+func (x *xdccHelper) Cancel(bot string, number int) error {
+	x.mu.Lock()
+	var req *xdccRequest
+	for _, r := range x.requests {
+		if strings.EqualFold(r.bot, bot) && r.number == number && r.state < XDCC_DONE {
+			req = r
+		}
+	}
+	x.mu.Unlock()
+	if req == nil {
+		return fmt.Errorf("no request for pack #%d from %s", number, bot)
+	}
+	switch req.state {
+	case XDCC_QUEUED, XDCC_REQUESTED:
+		x.servConn.conn.Privmsg(req.bot, fmt.Sprintf("XDCC REMOVE #%d", req.number))
+	case XDCC_TRANSFERRING:
+		req.transfer.Cancel()
+	}
+	x.finish(req, XDCC_CANCELLED, "")
+	return nil
+}
+
+// Requests returns every request we've made, oldest first
+func (x *xdccHelper) Requests() []*xdccRequest {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]*xdccRequest{}, x.requests...)
+}
+
+// RequestState returns what's going on with a pack, for the table
+func (x *xdccHelper) RequestState(bot string, number int) string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i := len(x.requests) - 1; i >= 0; i-- {
+		req := x.requests[i]
+		if strings.EqualFold(req.bot, bot) && req.number == number {
+			if req.state == XDCC_QUEUED && req.position > 0 {
+				return fmt.Sprintf("queued (%d)", req.position)
+			}
+			return xdccStateString(req.state)
+		}
+	}
+	return ""
+}
+
+// Search returns the packs with every word in their name (or bot)
+func (x *xdccHelper) Search(words ...string) []*xdccPack {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	ret := []*xdccPack{}
+	for _, packs := range x.packs {
+		for _, pack := range packs {
+			if xdccMatch(pack, words) {
+				ret = append(ret, pack)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].bot != ret[j].bot {
+			return strings.ToLower(ret[i].bot) < strings.ToLower(ret[j].bot)
+		}
+		return ret[i].number < ret[j].number
+	})
+	return ret
+}
+
+func xdccMatch(pack *xdccPack, words []string) bool {
+	haystack := strings.ToLower(pack.bot + " " + pack.name)
+	for _, w := range words {
+		if !strings.Contains(haystack, strings.ToLower(w)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clear forgets every pack we've seen
+func (x *xdccHelper) Clear() {
+	x.mu.Lock()
+	x.packs = map[string]map[int]*xdccPack{}
+	x.mu.Unlock()
+	x.refresh()
+}
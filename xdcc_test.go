@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseXdccPack(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		pack *xdccPack
+	}{
+		{"#1   12x [1.2G] Some.File.Name.mkv", &xdccPack{"bot", 1, 12, "1.2G", "Some.File.Name.mkv"}},
+		{"\x02#42\x02  0x [ 350M] file with spaces.zip  ", &xdccPack{"bot", 42, 0, "350M", "file with spaces.zip"}},
+		{"\x0304#3\x03 1024x [<1K] tiny.txt", &xdccPack{"bot", 3, 1024, "<1K", "tiny.txt"}},
+		{"** 5 packs **  1 of 3 slots open", nil},
+		{"#chan is a channel", nil},
+		{"#1 12x [1.2G]", nil},
+	} {
+		if pack := parseXdccPack("bot", test.line); !reflect.DeepEqual(pack, test.pack) {
+			t.Errorf("parseXdccPack(%q): expected %+v got %+v", test.line, test.pack, pack)
+		}
+	}
+}
+
+func TestXdccPositionRegex(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		position string
+	}{
+		{`** All Slots Full, Added you to the main queue for pack 5 ("file.mkv") in position 3.`, "3"},
+		{`Queued 0h1m for "file.mkv", in position 2 of 10. 1h3m or less remaining.`, "2"},
+		{`You are in position #12 in the queue`, "12"},
+		{`** Sending you pack #5 ("file.mkv")`, ""},
+	} {
+		position := ""
+		if m := xdccPositionRegex.FindStringSubmatch(test.text); m != nil {
+			position = m[1]
+		}
+		if position != test.position {
+			t.Errorf("%q: expected position %q got %q", test.text, test.position, position)
+		}
+	}
+}